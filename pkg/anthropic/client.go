@@ -0,0 +1,672 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/llm"
+	"github.com/gptscript-ai/gptscript/pkg/system"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	DefaultBaseURL    = "https://api.anthropic.com"
+	DefaultAPIVersion = "2023-06-01"
+	DefaultMaxTokens  = 4096
+)
+
+var completionID int64
+
+type Client struct {
+	baseURL      string
+	apiKey       string
+	apiVersion   string
+	cache        *cache.Client
+	cacheKeyBase string
+	httpClient   *http.Client
+	models       *llm.ModelList
+}
+
+type Options struct {
+	BaseURL    string        `usage:"Anthropic base URL" name:"anthropic-base-url" env:"ANTHROPIC_BASE_URL"`
+	APIKey     string        `usage:"Anthropic API KEY" name:"anthropic-api-key" env:"ANTHROPIC_API_KEY"`
+	APIVersion string        `usage:"-"`
+	HTTPClient *http.Client  `usage:"-"`
+	ModelsTTL  time.Duration `usage:"-"`
+	Cache      *cache.Client
+}
+
+func complete(opts ...Options) (result Options, err error) {
+	for _, opt := range opts {
+		result.BaseURL = types.FirstSet(opt.BaseURL, result.BaseURL)
+		result.APIKey = types.FirstSet(opt.APIKey, result.APIKey)
+		result.APIVersion = types.FirstSet(opt.APIVersion, result.APIVersion)
+		result.HTTPClient = types.FirstSet(opt.HTTPClient, result.HTTPClient)
+		result.Cache = types.FirstSet(opt.Cache, result.Cache)
+		result.ModelsTTL = types.FirstSet(opt.ModelsTTL, result.ModelsTTL)
+	}
+
+	if result.Cache == nil {
+		result.Cache, err = cache.New(cache.Options{
+			DisableCache: true,
+		})
+	}
+
+	if result.BaseURL == "" {
+		result.BaseURL = DefaultBaseURL
+	}
+
+	if result.APIVersion == "" {
+		result.APIVersion = DefaultAPIVersion
+	}
+
+	if result.HTTPClient == nil {
+		result.HTTPClient = http.DefaultClient
+	}
+
+	return result, err
+}
+
+func NewClient(opts ...Options) (*Client, error) {
+	opt, err := complete(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		baseURL:      strings.TrimSuffix(opt.BaseURL, "/"),
+		apiKey:       opt.APIKey,
+		apiVersion:   opt.APIVersion,
+		cache:        opt.Cache,
+		cacheKeyBase: hash.ID(opt.APIKey, opt.BaseURL),
+		httpClient:   opt.HTTPClient,
+		models:       llm.NewModelList(opt.ModelsTTL),
+	}, nil
+}
+
+// Supports will only ever claim a model if an API key is configured, so that an unconfigured
+// Anthropic client never gets in the way of the other clients in the registry.
+func (c *Client) Supports(ctx context.Context, modelName string) (bool, error) {
+	if c.apiKey == "" {
+		return false, nil
+	}
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(models, modelName), nil
+}
+
+func (c *Client) ListModels(ctx context.Context, providers ...string) (result []string, _ error) {
+	// Only serve if providers is empty or "" is in the list
+	if len(providers) != 0 && !slices.Contains(providers, "") {
+		return nil, nil
+	}
+
+	if c.apiKey == "" {
+		return nil, nil
+	}
+
+	return c.models.Get(ctx, c.listModels)
+}
+
+// InvalidateModels drops the cached models of the client.
+func (c *Client) InvalidateModels() {
+	c.models.Invalidate()
+}
+
+func (c *Client) listModels(ctx context.Context) (result []string, _ error) {
+	var afterID string
+	for {
+		query := url.Values{"limit": []string{"1000"}}
+		if afterID != "" {
+			query.Set("after_id", afterID)
+		}
+
+		req, err := c.newRequest(ctx, http.MethodGet, "/v1/models?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var models modelList
+		if err := c.do(req, &models); err != nil {
+			return nil, err
+		}
+
+		for _, model := range models.Data {
+			result = append(result, model.ID)
+		}
+
+		if !models.HasMore || models.LastID == "" {
+			break
+		}
+		afterID = models.LastID
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body any) (*http.Request, error) {
+	var content io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		content = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, content)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", c.apiVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (c *Client) do(req *http.Request, out any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	data, _ := io.ReadAll(resp.Body)
+	var (
+		errResp errorResponse
+		err     = fmt.Errorf("error, status code: %d, message: %s", resp.StatusCode, data)
+	)
+	if json.Unmarshal(data, &errResp) == nil && errResp.Error.Message != "" {
+		err = fmt.Errorf("error, status code: %d, type: %s, message: %s", resp.StatusCode, errResp.Error.Type, errResp.Error.Message)
+	}
+
+	// Another model may answer when this one is not found, busy or given a prompt longer than its context
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout, 529:
+		return &llm.ErrModelUnavailable{Err: err}
+	}
+	if strings.Contains(errResp.Error.Message, "prompt is too long") {
+		return &llm.ErrModelUnavailable{Err: err}
+	}
+	return err
+}
+
+func (c *Client) cacheKey(request messagesRequest) string {
+	return hash.Encode(map[string]any{
+		"base":    c.cacheKeyBase,
+		"request": request,
+	})
+}
+
+func (c *Client) fromCache(ctx context.Context, messageRequest types.CompletionRequest, request messagesRequest) (result types.CompletionMessage, _ bool, _ error) {
+	if cache.IsNoCache(ctx) {
+		return result, false, nil
+	}
+	if messageRequest.Cache != nil && !*messageRequest.Cache {
+		return result, false, nil
+	}
+
+	cache, found, err := c.cache.Get(c.cacheKey(request))
+	if err != nil {
+		return result, false, err
+	} else if !found {
+		return result, false, nil
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(cache))
+	if err != nil {
+		return result, false, err
+	}
+	return result, true, json.NewDecoder(gz).Decode(&result)
+}
+
+func (c *Client) store(ctx context.Context, key string, result types.CompletionMessage) error {
+	if cache.IsNoCache(ctx) {
+		return nil
+	}
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	if err := json.NewEncoder(gz).Encode(result); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return c.cache.Store(key, buf.Bytes())
+}
+
+func toolInput(arguments string) json.RawMessage {
+	if arguments == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+func toMessages(request types.CompletionRequest) (systemPrompt string, result []message) {
+	var systemPrompts []string
+
+	if request.InternalSystemPrompt == nil || *request.InternalSystemPrompt {
+		systemPrompts = append(systemPrompts, system.InternalSystemPrompt)
+	}
+
+	for _, msg := range request.Messages {
+		var (
+			role   string
+			blocks []contentBlock
+		)
+
+		switch msg.Role {
+		case types.CompletionMessageRoleTypeSystem:
+			var text []string
+			for _, content := range msg.Content {
+				if content.Text != "" {
+					text = append(text, content.Text)
+				}
+			}
+			if len(text) > 0 {
+				systemPrompts = append(systemPrompts, strings.Join(text, "\n"))
+			}
+			continue
+		case types.CompletionMessageRoleTypeTool:
+			// Tool results are sent back as user messages in the Messages API
+			role = string(types.CompletionMessageRoleTypeUser)
+			var text []string
+			for _, content := range msg.Content {
+				text = append(text, content.Text)
+			}
+			if msg.ToolCall != nil {
+				blocks = append(blocks, contentBlock{
+					Type:      "tool_result",
+					ToolUseID: msg.ToolCall.ID,
+					Content:   strings.Join(text, "\n"),
+				})
+			}
+			for _, content := range msg.Content {
+				if content.Image != nil {
+					blocks = append(blocks, toImage(*content.Image))
+				}
+			}
+		default:
+			role = string(msg.Role)
+			for _, content := range msg.Content {
+				if content.ToolCall != nil {
+					blocks = append(blocks, contentBlock{
+						Type:  "tool_use",
+						ID:    content.ToolCall.ID,
+						Name:  content.ToolCall.Function.Name,
+						Input: toolInput(content.ToolCall.Function.Arguments),
+					})
+				}
+				text := content.Text
+				if prompt, ok := system.IsDefaultPrompt(text); ok {
+					text = prompt
+				}
+				if content.Image != nil {
+					blocks = append(blocks, toImage(*content.Image))
+				}
+				if text == "" || text == "." || text == "{}" {
+					continue
+				}
+				blocks = append(blocks, contentBlock{
+					Type: "text",
+					Text: text,
+				})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		// The Messages API requires alternating roles, so consecutive messages of the same role,
+		// such as the results of parallel tool calls, are merged together.
+		if len(result) > 0 && result[len(result)-1].Role == role {
+			merged := append(result[len(result)-1].Content, blocks...)
+			// Tool results must come before any other content, such as the images of a previous result
+			slices.SortStableFunc(merged, func(a, b contentBlock) int {
+				return toolResultOrder(a) - toolResultOrder(b)
+			})
+			result[len(result)-1].Content = merged
+			continue
+		}
+
+		result = append(result, message{
+			Role:    role,
+			Content: blocks,
+		})
+	}
+
+	// The Messages API has no structured output, so the schema is asked for in the system prompt
+	// and the response is validated by the caller.
+	if request.OutputSchema != nil {
+		schema, _ := json.Marshal(request.OutputSchema)
+		systemPrompts = append(systemPrompts, "Respond only with a JSON value matching this JSON schema, without any other text:\n"+string(schema))
+	}
+
+	return strings.Join(systemPrompts, "\n"), result
+}
+
+func toolResultOrder(block contentBlock) int {
+	if block.Type == "tool_result" {
+		return 0
+	}
+	return 1
+}
+
+func toImage(image types.ImageURL) contentBlock {
+	// Data URLs are in the format data:image/png;base64,DATA
+	if header, data, ok := strings.Cut(strings.TrimPrefix(image.URL, "data:"), ";base64,"); ok && strings.HasPrefix(image.URL, "data:") {
+		return contentBlock{
+			Type: "image",
+			Source: &imageSource{
+				Type:      "base64",
+				MediaType: header,
+				Data:      data,
+			},
+		}
+	}
+	return contentBlock{
+		Type: "image",
+		Source: &imageSource{
+			Type: "url",
+			URL:  image.URL,
+		},
+	}
+}
+
+func toTools(request types.CompletionRequest) (result []tool) {
+	for _, t := range request.Tools {
+		schema := t.Function.Parameters
+		if schema == nil {
+			schema = &openapi3.Schema{
+				Type:       "object",
+				Properties: openapi3.Schemas{},
+			}
+		}
+		result = append(result, tool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	return
+}
+
+func (c *Client) Call(ctx context.Context, messageRequest types.CompletionRequest, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	if c.apiKey == "" {
+		return nil, fmt.Errorf("ANTHROPIC_API_KEY is not set. Please set the ANTHROPIC_API_KEY environment variable")
+	}
+
+	systemPrompt, msgs := toMessages(messageRequest)
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("invalid request, no messages to send to LLM")
+	}
+
+	request := messagesRequest{
+		Model:       messageRequest.Model,
+		System:      systemPrompt,
+		Messages:    msgs,
+		Tools:       toTools(messageRequest),
+		MaxTokens:   messageRequest.MaxTokens,
+		Temperature: messageRequest.Temperature,
+	}
+
+	if request.MaxTokens == 0 {
+		request.MaxTokens = DefaultMaxTokens
+	}
+
+	if messageRequest.DisableToolCalls && len(request.Tools) > 0 {
+		request.ToolChoice = &toolChoice{Type: "none"}
+	}
+
+	if request.Temperature == nil {
+		request.Temperature = new(float32)
+	}
+
+	id := fmt.Sprint(atomic.AddInt64(&completionID, 1))
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Request:      request,
+	}
+
+	var usage types.Usage
+	result, cached, err := c.fromCache(ctx, messageRequest, request)
+	if err != nil {
+		return nil, err
+	} else if !cached {
+		result, usage, err = c.call(ctx, request, id, status)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Response:     result,
+		Usage:        usage,
+		Cached:       cached,
+	}
+
+	return &result, nil
+}
+
+func (c *Client) call(ctx context.Context, request messagesRequest, transactionID string, partial chan<- types.CompletionStatus) (result types.CompletionMessage, _ types.Usage, _ error) {
+	cacheKey := c.cacheKey(request)
+	request.Stream = true
+
+	partial <- types.CompletionStatus{
+		CompletionID: transactionID,
+		PartialResponse: &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text("Waiting for model response..."),
+		},
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/v1/messages", request)
+	if err != nil {
+		return result, types.Usage{}, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return result, types.Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return result, types.Usage{}, err
+	}
+
+	var (
+		acc  = accumulator{}
+		scan = bufio.NewScanner(resp.Body)
+	)
+	scan.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for scan.Scan() {
+		data, ok := strings.CutPrefix(scan.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		var event streamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return result, types.Usage{}, fmt.Errorf("failed to decode stream event: %w", err)
+		}
+
+		if event.Type == "error" && event.Error != nil {
+			err := fmt.Errorf("error from model, type: %s, message: %s", event.Error.Type, event.Error.Message)
+			if event.Error.Type == "overloaded_error" || event.Error.Type == "api_error" || event.Error.Type == "rate_limit_error" {
+				err = &llm.ErrModelUnavailable{Err: err}
+			}
+			return result, types.Usage{}, err
+		}
+
+		if !acc.add(event) {
+			continue
+		}
+
+		if partial != nil {
+			partialMessage := acc.message()
+			partial <- types.CompletionStatus{
+				CompletionID:    transactionID,
+				PartialResponse: &partialMessage,
+			}
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return result, types.Usage{}, err
+	}
+
+	result = acc.message()
+	return result, acc.usage(), c.store(ctx, cacheKey, result)
+}
+
+// accumulator builds a types.CompletionMessage from the stream of content block events.
+type accumulator struct {
+	msg types.CompletionMessage
+	// blocks maps the index of a content block in the stream to the index in msg.Content
+	blocks    map[int]int
+	toolCalls int
+	tokens    usage
+}
+
+// add applies the event and returns true if the message content changed.
+func (a *accumulator) add(event streamEvent) bool {
+	if a.blocks == nil {
+		a.blocks = map[int]int{}
+		a.msg.Role = types.CompletionMessageRoleTypeAssistant
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil && event.Message.Usage != nil {
+			a.tokens = *event.Message.Usage
+		}
+	case "message_delta":
+		// The output token count in message_delta is cumulative
+		if event.Usage != nil {
+			a.tokens.OutputTokens = event.Usage.OutputTokens
+		}
+	case "content_block_start":
+		if event.ContentBlock == nil {
+			return false
+		}
+		switch event.ContentBlock.Type {
+		case "tool_use":
+			a.blocks[event.Index] = len(a.msg.Content)
+			a.msg.Content = append(a.msg.Content, types.ContentPart{
+				ToolCall: &types.CompletionToolCall{
+					Index: ptr(a.toolCalls),
+					ID:    event.ContentBlock.ID,
+					Function: types.CompletionFunctionCall{
+						Name: event.ContentBlock.Name,
+					},
+				},
+			})
+			a.toolCalls++
+			return true
+		case "text":
+			// All text is collapsed into a single content part
+			for i, content := range a.msg.Content {
+				if content.ToolCall == nil {
+					a.blocks[event.Index] = i
+					return a.appendText(i, event.ContentBlock.Text)
+				}
+			}
+			a.blocks[event.Index] = len(a.msg.Content)
+			a.msg.Content = append(a.msg.Content, types.ContentPart{
+				Text: event.ContentBlock.Text,
+			})
+			return true
+		}
+	case "content_block_delta":
+		i, ok := a.blocks[event.Index]
+		if !ok || event.Delta == nil {
+			return false
+		}
+		switch event.Delta.Type {
+		case "text_delta":
+			return a.appendText(i, event.Delta.Text)
+		case "input_json_delta":
+			a.msg.Content[i].ToolCall.Function.Arguments += event.Delta.PartialJSON
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *accumulator) appendText(i int, text string) bool {
+	if text == "" {
+		return false
+	}
+	a.msg.Content[i].Text += text
+	return true
+}
+
+func (a *accumulator) usage() types.Usage {
+	prompt := a.tokens.InputTokens + a.tokens.CacheCreationInputTokens + a.tokens.CacheReadInputTokens
+	return types.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: a.tokens.OutputTokens,
+		CachedTokens:     a.tokens.CacheReadInputTokens,
+		TotalTokens:      prompt + a.tokens.OutputTokens,
+	}
+}
+
+func (a *accumulator) message() types.CompletionMessage {
+	result := types.CompletionMessage{
+		Role: a.msg.Role,
+	}
+	for _, content := range a.msg.Content {
+		if content.ToolCall != nil {
+			toolCall := *content.ToolCall
+			if toolCall.Function.Arguments == "" {
+				toolCall.Function.Arguments = "{}"
+			}
+			content.ToolCall = &toolCall
+		}
+		result.Content = append(result.Content, content)
+	}
+	return result
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,255 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/llm"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStub(t *testing.T, events []string) (*Client, *messagesRequest) {
+	t.Helper()
+
+	var received messagesRequest
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+		assert.Equal(t, DefaultAPIVersion, r.Header.Get("anthropic-version"))
+
+		switch r.URL.Path {
+		case "/v1/models":
+			_, _ = w.Write([]byte(`{"data":[{"id":"claude-b"},{"id":"claude-a"}],"has_more":false}`))
+		case "/v1/messages":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, event := range events {
+				_, _ = fmt.Fprintf(w, "event: x\ndata: %s\n\n", event)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"not_found_error","message":"not found"}}`))
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	c, err := NewClient(Options{
+		BaseURL: s.URL,
+		APIKey:  "test-key",
+	})
+	require.NoError(t, err)
+	return c, &received
+}
+
+func drain() (chan types.CompletionStatus, func() types.Usage) {
+	var (
+		status = make(chan types.CompletionStatus)
+		done   = make(chan struct{})
+		usage  types.Usage
+	)
+	go func() {
+		defer close(done)
+		for s := range status {
+			usage = usage.Add(s.Usage)
+		}
+	}()
+	return status, func() types.Usage {
+		close(status)
+		<-done
+		return usage
+	}
+}
+
+func TestListModels(t *testing.T) {
+	c, _ := newStub(t, nil)
+
+	models, err := c.ListModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claude-a", "claude-b"}, models)
+
+	ok, err := c.Supports(context.Background(), "claude-a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = c.Supports(context.Background(), "gpt-4o")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	unconfigured, err := NewClient()
+	require.NoError(t, err)
+	ok, err = unconfigured.Supports(context.Background(), "claude-a")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCall(t *testing.T) {
+	c, received := newStub(t, []string{
+		`{"type":"message_start","message":{"id":"msg_1","role":"assistant","model":"claude-a","usage":{"input_tokens":10,"cache_read_input_tokens":5,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"check."}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"weather","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":7}}`,
+		`{"type":"message_stop"}`,
+	})
+
+	status, done := drain()
+
+	resp, err := c.Call(context.Background(), types.CompletionRequest{
+		Model:                "claude-a",
+		InternalSystemPrompt: new(bool),
+		Tools: []types.CompletionTool{
+			{
+				Function: types.CompletionFunctionDefinition{
+					Name:        "weather",
+					Description: "Get the weather",
+					Parameters:  types.ObjectSchema("city", "The city"),
+				},
+			},
+		},
+		Messages: []types.CompletionMessage{
+			{
+				Role:    types.CompletionMessageRoleTypeSystem,
+				Content: types.Text("You are a weather bot"),
+			},
+			{
+				Role:    types.CompletionMessageRoleTypeUser,
+				Content: types.Text("What is the weather?"),
+			},
+			{
+				Role: types.CompletionMessageRoleTypeAssistant,
+				Content: []types.ContentPart{
+					{ToolCall: &types.CompletionToolCall{ID: "toolu_0", Function: types.CompletionFunctionCall{Name: "weather", Arguments: `{"city":"Rome"}`}}},
+					{ToolCall: &types.CompletionToolCall{ID: "toolu_00", Function: types.CompletionFunctionCall{Name: "weather", Arguments: `{"city":"Oslo"}`}}},
+				},
+			},
+			{
+				Role:     types.CompletionMessageRoleTypeTool,
+				Content:  types.Text("sunny"),
+				ToolCall: &types.CompletionToolCall{ID: "toolu_0"},
+			},
+			{
+				Role:     types.CompletionMessageRoleTypeTool,
+				Content:  types.Text("cold"),
+				ToolCall: &types.CompletionToolCall{ID: "toolu_00"},
+			},
+		},
+	}, status)
+	require.NoError(t, err)
+	assert.Equal(t, types.Usage{
+		PromptTokens:     15,
+		CompletionTokens: 7,
+		CachedTokens:     5,
+		TotalTokens:      22,
+	}, done())
+
+	assert.Equal(t, "You are a weather bot", received.System)
+	assert.Equal(t, DefaultMaxTokens, received.MaxTokens)
+	assert.True(t, received.Stream)
+	require.Len(t, received.Tools, 1)
+	assert.Equal(t, "weather", received.Tools[0].Name)
+	require.Len(t, received.Messages, 3)
+	assert.Equal(t, "user", received.Messages[0].Role)
+	assert.Equal(t, "assistant", received.Messages[1].Role)
+	assert.Equal(t, "tool_use", received.Messages[1].Content[0].Type)
+	assert.JSONEq(t, `{"city":"Rome"}`, string(received.Messages[1].Content[0].Input))
+	// Both tool results are merged into a single user message
+	assert.Equal(t, "user", received.Messages[2].Role)
+	require.Len(t, received.Messages[2].Content, 2)
+	assert.Equal(t, "tool_result", received.Messages[2].Content[1].Type)
+	assert.Equal(t, "toolu_00", received.Messages[2].Content[1].ToolUseID)
+	assert.Equal(t, "cold", received.Messages[2].Content[1].Content)
+
+	require.Len(t, resp.Content, 2)
+	assert.Equal(t, types.CompletionMessageRoleTypeAssistant, resp.Role)
+	assert.Equal(t, "Let me check.", resp.Content[0].Text)
+	require.NotNil(t, resp.Content[1].ToolCall)
+	assert.Equal(t, "toolu_1", resp.Content[1].ToolCall.ID)
+	assert.Equal(t, 0, *resp.Content[1].ToolCall.Index)
+	assert.Equal(t, "weather", resp.Content[1].ToolCall.Function.Name)
+	assert.Equal(t, `{"city":"Paris"}`, resp.Content[1].ToolCall.Function.Arguments)
+}
+
+func TestCallError(t *testing.T) {
+	c, _ := newStub(t, []string{
+		`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	})
+
+	status, done := drain()
+	defer done()
+
+	_, err := c.Call(context.Background(), types.CompletionRequest{
+		Model:    "claude-a",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hi")}},
+	}, status)
+	require.ErrorContains(t, err, "overloaded_error")
+	unavailable := (*llm.ErrModelUnavailable)(nil)
+	assert.True(t, errors.As(err, &unavailable))
+}
+
+func TestToMessagesImages(t *testing.T) {
+	_, msgs := toMessages(types.CompletionRequest{
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{
+				Role:    types.CompletionMessageRoleTypeUser,
+				Content: []types.ContentPart{{Text: "What is this?"}, {Image: &types.ImageURL{URL: "https://example.com/a.png"}}},
+			},
+			{
+				Role: types.CompletionMessageRoleTypeAssistant,
+				Content: []types.ContentPart{
+					{ToolCall: &types.CompletionToolCall{ID: "toolu_1", Function: types.CompletionFunctionCall{Name: "read"}}},
+					{ToolCall: &types.CompletionToolCall{ID: "toolu_2", Function: types.CompletionFunctionCall{Name: "read"}}},
+				},
+			},
+			{
+				Role:     types.CompletionMessageRoleTypeTool,
+				Content:  []types.ContentPart{{Image: &types.ImageURL{URL: "data:image/png;base64,AAAA"}}},
+				ToolCall: &types.CompletionToolCall{ID: "toolu_1"},
+			},
+			{
+				Role:     types.CompletionMessageRoleTypeTool,
+				Content:  types.Text("done"),
+				ToolCall: &types.CompletionToolCall{ID: "toolu_2"},
+			},
+		},
+	})
+	require.Len(t, msgs, 3)
+
+	require.Len(t, msgs[0].Content, 2)
+	assert.Equal(t, "image", msgs[0].Content[1].Type)
+	assert.Equal(t, &imageSource{Type: "url", URL: "https://example.com/a.png"}, msgs[0].Content[1].Source)
+
+	// Tool results come first, followed by the image of the first result
+	require.Len(t, msgs[2].Content, 3)
+	assert.Equal(t, "tool_result", msgs[2].Content[0].Type)
+	assert.Equal(t, "tool_result", msgs[2].Content[1].Type)
+	assert.Equal(t, "image", msgs[2].Content[2].Type)
+	assert.Equal(t, &imageSource{Type: "base64", MediaType: "image/png", Data: "AAAA"}, msgs[2].Content[2].Source)
+}
+
+func TestToMessagesSystem(t *testing.T) {
+	systemPrompt, msgs := toMessages(types.CompletionRequest{
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeSystem},
+			{
+				Role:    types.CompletionMessageRoleTypeSystem,
+				Content: []types.ContentPart{{Text: "Be helpful"}, {Text: "Be brief"}},
+			},
+			{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Hi")},
+		},
+	})
+	assert.Equal(t, "Be helpful\nBe brief", systemPrompt)
+	require.Len(t, msgs, 1)
+}
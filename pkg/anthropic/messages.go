@@ -0,0 +1,101 @@
+package anthropic
+
+import (
+	"encoding/json"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// The types in this file are the wire format of the Anthropic Messages API.
+
+type messagesRequest struct {
+	Model       string      `json:"model"`
+	System      string      `json:"system,omitempty"`
+	Messages    []message   `json:"messages"`
+	Tools       []tool      `json:"tools,omitempty"`
+	MaxTokens   int         `json:"max_tokens"`
+	Temperature *float32    `json:"temperature,omitempty"`
+	Stream      bool        `json:"stream,omitempty"`
+	ToolChoice  *toolChoice `json:"tool_choice,omitempty"`
+}
+
+type toolChoice struct {
+	Type string `json:"type"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	Source    *imageSource    `json:"source,omitempty"`
+}
+
+type imageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type tool struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	InputSchema *openapi3.Schema `json:"input_schema"`
+}
+
+type streamEvent struct {
+	Type         string        `json:"type"`
+	Index        int           `json:"index"`
+	Message      *messageStart `json:"message,omitempty"`
+	ContentBlock *contentBlock `json:"content_block,omitempty"`
+	Delta        *delta        `json:"delta,omitempty"`
+	Usage        *usage        `json:"usage,omitempty"`
+	Error        *apiError     `json:"error,omitempty"`
+}
+
+type messageStart struct {
+	ID    string `json:"id"`
+	Model string `json:"model"`
+	Role  string `json:"role"`
+	Usage *usage `json:"usage,omitempty"`
+}
+
+type usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type delta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	StopReason  string `json:"stop_reason,omitempty"`
+}
+
+type apiError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error apiError `json:"error"`
+}
+
+type modelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+	HasMore bool   `json:"has_more"`
+	LastID  string `json:"last_id"`
+}
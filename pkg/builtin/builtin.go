@@ -45,7 +45,7 @@ var tools = map[string]types.Tool{
 	},
 	"sys.workspace.read": {
 		Parameters: types.Parameters{
-			Description: "Reads the contents of a file relative to the current workspace",
+			Description: "Reads the contents of a file relative to the current workspace, image files are returned as images",
 			Arguments: types.ObjectSchema(
 				"filename", "The name of the file to read"),
 		},
@@ -61,7 +61,7 @@ var tools = map[string]types.Tool{
 	},
 	"sys.read": {
 		Parameters: types.Parameters{
-			Description: "Reads the contents of a file",
+			Description: "Reads the contents of a file, image files are returned as images",
 			Arguments: types.ObjectSchema(
 				"filename", "The name of the file to read"),
 		},
@@ -421,6 +421,15 @@ func sysRead(ctx context.Context, base string, env []string, input string) (stri
 	if len(data) == 0 {
 		return fmt.Sprintf("The file %s has no contents", params.Filename), nil
 	}
+
+	if types.IsImageFile(file) {
+		// Returned as an image envelope so the image is sent to the model rather than its bytes
+		url, err := types.ImageDataURL(file, data)
+		if err != nil {
+			return "", err
+		}
+		return types.ContentString([]types.ContentPart{{Image: &types.ImageURL{URL: url}}}), nil
+	}
 	return string(data), nil
 }
 
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !windows
+
+package cache
+
+import (
+	"io/fs"
+	"time"
+)
+
+func accessTime(info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
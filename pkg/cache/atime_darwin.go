@@ -0,0 +1,14 @@
+package cache
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+func accessTime(info fs.FileInfo) time.Time {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(stat.Atimespec.Unix())
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"time"
+)
+
+// Backend stores the cached LLM responses.
+type Backend interface {
+	Get(key string) ([]byte, bool, error)
+	Store(key string, content []byte) error
+	List() ([]Entry, error)
+	Remove(key string) error
+}
+
+type EntryKind string
+
+const (
+	// EntryResponse is a cached LLM response
+	EntryResponse EntryKind = "response"
+	// EntryRepo is a directory of repos/, a checkout of a tool repo or a runtime it uses
+	EntryRepo EntryKind = "repo"
+)
+
+type Entry struct {
+	Kind     EntryKind `json:"kind"`
+	Key      string    `json:"key"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"lastUsed"`
+}
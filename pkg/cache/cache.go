@@ -3,9 +3,11 @@ package cache
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/gptscript-ai/gptscript/pkg/types"
@@ -13,19 +15,26 @@ import (
 )
 
 type Client struct {
-	dir  string
-	noop bool
+	dir     string
+	noop    bool
+	backend Backend
 }
 
 type Options struct {
-	DisableCache bool   `usage:"Disable caching of LLM API responses"`
-	CacheDir     string `usage:"Directory to store cache (default: $XDG_CACHE_HOME/gptscript)"`
+	DisableCache bool    `usage:"Disable caching of LLM API responses"`
+	CacheDir     string  `usage:"Directory to store cache (default: $XDG_CACHE_HOME/gptscript)"`
+	CacheMaxSize string  `usage:"Maximum size of the cached LLM responses, the least recently used are removed first (ex: 500MB) (default unlimited)"`
+	CacheTTL     string  `usage:"How long cached LLM responses are used (ex: 24h) (default forever)"`
+	Backend      Backend `usage:"-" json:"-"`
 }
 
 func Complete(opts ...Options) (result Options) {
 	for _, opt := range opts {
 		result.CacheDir = types.FirstSet(opt.CacheDir, result.CacheDir)
 		result.DisableCache = types.FirstSet(opt.DisableCache, result.DisableCache)
+		result.CacheMaxSize = types.FirstSet(opt.CacheMaxSize, result.CacheMaxSize)
+		result.CacheTTL = types.FirstSet(opt.CacheTTL, result.CacheTTL)
+		result.Backend = types.FirstSet(opt.Backend, result.Backend)
 	}
 	if result.CacheDir == "" {
 		result.CacheDir = filepath.Join(xdg.CacheHome, version.ProgramName)
@@ -49,9 +58,27 @@ func New(opts ...Options) (*Client, error) {
 	if err := os.MkdirAll(opt.CacheDir, 0755); err != nil {
 		return nil, err
 	}
+
+	backend := opt.Backend
+	if backend == nil {
+		maxSize, err := ParseSize(opt.CacheMaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache max size %q: %w", opt.CacheMaxSize, err)
+		}
+		var ttl time.Duration
+		if opt.CacheTTL != "" {
+			ttl, err = time.ParseDuration(opt.CacheTTL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cache TTL %q: %w", opt.CacheTTL, err)
+			}
+		}
+		backend = NewFileBackend(opt.CacheDir, maxSize, ttl)
+	}
+
 	return &Client{
-		dir:  opt.CacheDir,
-		noop: opt.DisableCache,
+		dir:     opt.CacheDir,
+		noop:    opt.DisableCache,
+		backend: backend,
 	}, nil
 }
 
@@ -63,18 +90,92 @@ func (c *Client) Store(key string, content []byte) error {
 	if c == nil || c.noop {
 		return nil
 	}
-	return os.WriteFile(filepath.Join(c.dir, key), content, 0644)
+	return c.backend.Store(key, content)
 }
 
 func (c *Client) Get(key string) ([]byte, bool, error) {
 	if c == nil || c.noop {
 		return nil, false, nil
 	}
-	data, err := os.ReadFile(filepath.Join(c.dir, key))
+	return c.backend.Get(key)
+}
+
+// Entries returns the cached LLM responses and the directories of repos/.
+func (c *Client) Entries() ([]Entry, error) {
+	result, err := c.backend.List()
+	if err != nil {
+		return nil, err
+	}
+
+	repos, err := os.ReadDir(c.reposDir())
 	if errors.Is(err, fs.ErrNotExist) {
-		return nil, false, nil
+		return result, nil
 	} else if err != nil {
-		return nil, false, err
+		return nil, err
 	}
-	return data, true, nil
+
+	for _, repo := range repos {
+		if !repo.IsDir() {
+			continue
+		}
+		entry := Entry{
+			Kind: EntryRepo,
+			Key:  repo.Name(),
+		}
+		err := filepath.WalkDir(filepath.Join(c.reposDir(), repo.Name()), func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				entry.Size += info.Size()
+			}
+			if modTime := info.ModTime(); modTime.After(entry.LastUsed) {
+				entry.LastUsed = modTime
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+func (c *Client) Remove(entry Entry) error {
+	if entry.Kind == EntryRepo {
+		return os.RemoveAll(filepath.Join(c.reposDir(), entry.Key))
+	}
+	return c.backend.Remove(entry.Key)
+}
+
+// Prune removes the entries that were not used for longer than olderThan, or all the entries if olderThan is
+// zero, and returns the removed entries.
+func (c *Client) Prune(olderThan time.Duration) (result []Entry, _ error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	for _, entry := range entries {
+		if olderThan > 0 && entry.LastUsed.After(cutoff) {
+			continue
+		}
+		if err := c.Remove(entry); err != nil {
+			return result, fmt.Errorf("failed to remove %s %s: %w", entry.Kind, entry.Key, err)
+		}
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+func (c *Client) reposDir() string {
+	return filepath.Join(c.dir, "repos")
 }
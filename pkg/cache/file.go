@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// responsesDir is the directory of the cache where FileBackend stores the responses. The version changes when
+// the format of the entries does, so that old entries are not used.
+const responsesDir = "responses-v1"
+
+// FileBackend stores each entry as a file of a directory. Entries expire ttl after they are stored, and once
+// the entries are larger than maxSize the least recently used are removed. Zero disables either limit.
+// The cache directory may be shared, so only the files named by a key in the responses directory are entries.
+type FileBackend struct {
+	lock    sync.Mutex
+	dir     string
+	maxSize int64
+	ttl     time.Duration
+}
+
+func NewFileBackend(dir string, maxSize int64, ttl time.Duration) *FileBackend {
+	return &FileBackend{
+		dir:     filepath.Join(dir, responsesDir),
+		maxSize: maxSize,
+		ttl:     ttl,
+	}
+}
+
+func (f *FileBackend) Get(key string) ([]byte, bool, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if f.ttl > 0 && time.Since(info.ModTime()) > f.ttl {
+		return nil, false, f.Remove(key)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	// The access time records the last use for the eviction, the modification time when the entry expires
+	_ = os.Chtimes(path, time.Now(), info.ModTime())
+	return data, true, nil
+}
+
+func (f *FileBackend) Store(key string, content []byte) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return err
+	}
+	if f.maxSize > 0 {
+		return f.evict()
+	}
+	return nil
+}
+
+func (f *FileBackend) List() (result []Entry, _ error) {
+	files, err := os.ReadDir(f.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if !file.Type().IsRegular() || !isKey(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result = append(result, Entry{
+			Kind:     EntryResponse,
+			Key:      file.Name(),
+			Size:     info.Size(),
+			LastUsed: lastUsed(info),
+		})
+	}
+
+	return result, nil
+}
+
+func (f *FileBackend) Remove(key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// evict removes the least recently used entries until the entries fit in maxSize.
+func (f *FileBackend) evict() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	entries, err := f.List()
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+
+	for _, entry := range entries {
+		if size <= f.maxSize {
+			break
+		}
+		if err := f.Remove(entry.Key); err != nil {
+			return err
+		}
+		size -= entry.Size
+	}
+
+	return nil
+}
+
+func (f *FileBackend) path(key string) (string, error) {
+	if !isKey(key) {
+		return "", fmt.Errorf("invalid cache key %q", key)
+	}
+	return filepath.Join(f.dir, key), nil
+}
+
+// isKey returns true if name is a cache key, the hex encoded SHA-256 of a request.
+func isKey(name string) bool {
+	if len(name) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+func lastUsed(info fs.FileInfo) time.Time {
+	if accessed := accessTime(info); accessed.After(info.ModTime()) {
+		return accessed
+	}
+	return info.ModTime()
+}
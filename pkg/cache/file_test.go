@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	keyA = hash.ID("a")
+	keyB = hash.ID("b")
+	keyC = hash.ID("c")
+)
+
+func setLastUsed(t *testing.T, dir, key string, lastUsed time.Time) {
+	t.Helper()
+	require.NoError(t, os.Chtimes(filepath.Join(dir, responsesDir, key), lastUsed, lastUsed))
+}
+
+func TestFileBackendEvict(t *testing.T) {
+	dir := t.TempDir()
+	f := NewFileBackend(dir, 10, 0)
+
+	require.NoError(t, f.Store(keyA, []byte("aaaa")))
+	require.NoError(t, f.Store(keyB, []byte("bbbb")))
+	setLastUsed(t, dir, keyA, time.Now().Add(-2*time.Hour))
+	setLastUsed(t, dir, keyB, time.Now().Add(-time.Hour))
+
+	// Using a makes b the least recently used
+	_, ok, err := f.Get(keyA)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, f.Store(keyC, []byte("cccc")))
+
+	_, ok, err = f.Get(keyB)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	for _, key := range []string{keyA, keyC} {
+		_, ok, err = f.Get(key)
+		require.NoError(t, err)
+		assert.True(t, ok, key)
+	}
+}
+
+func TestFileBackendTTL(t *testing.T) {
+	dir := t.TempDir()
+	f := NewFileBackend(dir, 0, time.Hour)
+
+	require.NoError(t, f.Store(keyA, []byte("old")))
+	require.NoError(t, f.Store(keyB, []byte("new")))
+	setLastUsed(t, dir, keyA, time.Now().Add(-2*time.Hour))
+
+	_, ok, err := f.Get(keyA)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoFileExists(t, filepath.Join(dir, responsesDir, keyA))
+
+	data, ok, err := f.Get(keyB)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(Options{
+		CacheDir: dir,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, c.Store(keyA, []byte("old")))
+	require.NoError(t, c.Store(keyB, []byte("new")))
+	setLastUsed(t, dir, keyA, time.Now().Add(-48*time.Hour))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "repos", "rev", "runtime"), 0755))
+
+	removed, err := c.Prune(24 * time.Hour)
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.Equal(t, keyA, removed[0].Key)
+
+	removed, err = c.Prune(0)
+	require.NoError(t, err)
+	assert.Len(t, removed, 2)
+	assert.NoDirExists(t, filepath.Join(dir, "repos", "rev"))
+}
+
+func TestFileBackendSharedDir(t *testing.T) {
+	dir := t.TempDir()
+	f := NewFileBackend(dir, 10, 0)
+
+	// Files of other programs in the cache directory are not entries of the backend
+	other := filepath.Join(dir, "other.txt")
+	stray := filepath.Join(dir, responsesDir, "notes.txt")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, responsesDir), 0755))
+	require.NoError(t, os.WriteFile(other, []byte("not a cache entry"), 0644))
+	require.NoError(t, os.WriteFile(stray, []byte("not a cache entry"), 0644))
+
+	require.NoError(t, f.Store(keyA, []byte("aaaa")))
+	setLastUsed(t, dir, keyA, time.Now().Add(-time.Hour))
+	require.NoError(t, f.Store(keyB, []byte("bbbbbbbb")))
+
+	entries, err := f.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, keyB, entries[0].Key)
+	assert.FileExists(t, other)
+	assert.FileExists(t, stray)
+
+	assert.Error(t, f.Store("../other.txt", []byte("x")))
+	assert.Error(t, f.Remove("notes.txt"))
+}
+
+func TestParseSize(t *testing.T) {
+	for size, expected := range map[string]int64{
+		"":      0,
+		"100":   100,
+		"2KB":   2048,
+		"1.5mb": 3 << 19,
+		"1 GB":  1 << 30,
+	} {
+		n, err := ParseSize(size)
+		require.NoError(t, err, size)
+		assert.Equal(t, expected, n, size)
+	}
+
+	_, err := ParseSize("big")
+	assert.Error(t, err)
+}
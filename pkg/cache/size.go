@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a size like 500MB or 2GB. An empty size is zero.
+func ParseSize(size string) (int64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	if size == "" {
+		return 0, nil
+	}
+
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(size, u.suffix) {
+			size, unit = strings.TrimSpace(strings.TrimSuffix(size, u.suffix)), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(size, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a size like 500MB")
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// FormatSize formats a size in bytes in the largest unit it has at least one of.
+func FormatSize(size int64) string {
+	for _, u := range sizeUnits {
+		if size >= u.size && u.size > 1 {
+			return fmt.Sprintf("%.1f %s", float64(size)/float64(u.size), u.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", size)
+}
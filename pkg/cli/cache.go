@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	cmd2 "github.com/acorn-io/cmd"
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/spf13/cobra"
+)
+
+type Cache struct {
+	root *GPTScript
+}
+
+func (c *Cache) Customize(cmd *cobra.Command) {
+	cmd.Use = "cache"
+	cmd.Short = "Manage the cached LLM responses and tool runtimes"
+	cmd.Args = cobra.NoArgs
+	cmd.AddCommand(
+		cmd2.Command(&CacheStats{root: c.root}),
+		cmd2.Command(&CacheList{root: c.root}),
+		cmd2.Command(&CachePrune{root: c.root}),
+		cmd2.Command(&CacheClear{root: c.root}),
+	)
+}
+
+func (c *Cache) Run(cmd *cobra.Command, _ []string) error {
+	return cmd.Help()
+}
+
+func (r *GPTScript) cacheEntries() (*cache.Client, []cache.Entry, error) {
+	client, err := cache.New(cache.Options(r.CacheOptions))
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := client.Entries()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list cache entries: %w", err)
+	}
+	return client, entries, nil
+}
+
+type CacheStats struct {
+	root *GPTScript
+}
+
+func (c *CacheStats) Customize(cmd *cobra.Command) {
+	cmd.Use = "stats"
+	cmd.Short = "Show the number and size of cache entries"
+	cmd.Args = cobra.NoArgs
+}
+
+func (c *CacheStats) Run(_ *cobra.Command, _ []string) error {
+	client, entries, err := c.root.cacheEntries()
+	if err != nil {
+		return err
+	}
+
+	var (
+		counts = map[cache.EntryKind]int{}
+		sizes  = map[cache.EntryKind]int64{}
+	)
+	for _, entry := range entries {
+		counts[entry.Kind]++
+		sizes[entry.Kind] += entry.Size
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 10, 1, 3, ' ', 0)
+	defer w.Flush()
+
+	_, _ = fmt.Fprintf(w, "DIRECTORY\t%s\n", client.CacheDir())
+	_, _ = w.Write([]byte("KIND\tENTRIES\tSIZE\n"))
+	for _, kind := range []cache.EntryKind{cache.EntryResponse, cache.EntryRepo} {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\n", kind, counts[kind], cache.FormatSize(sizes[kind]))
+	}
+	return nil
+}
+
+type CacheList struct {
+	root *GPTScript
+}
+
+func (c *CacheList) Customize(cmd *cobra.Command) {
+	cmd.Use = "list"
+	cmd.Aliases = []string{"ls"}
+	cmd.Short = "List the cache entries, least recently used first"
+	cmd.Args = cobra.NoArgs
+}
+
+func (c *CacheList) Run(_ *cobra.Command, _ []string) error {
+	_, entries, err := c.root.cacheEntries()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 10, 1, 3, ' ', 0)
+	defer w.Flush()
+
+	_, _ = w.Write([]byte("KIND\tKEY\tSIZE\tLAST USED\n"))
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Kind, entry.Key, cache.FormatSize(entry.Size), entry.LastUsed.Format(time.RFC3339))
+	}
+	return nil
+}
+
+type CachePrune struct {
+	root      *GPTScript
+	OlderThan string `usage:"Remove the entries not used for longer than this (ex: --older-than 720h)" local:"true"`
+}
+
+func (c *CachePrune) Customize(cmd *cobra.Command) {
+	cmd.Use = "prune"
+	cmd.Short = "Remove the cache entries that were not used recently"
+	cmd.Args = cobra.NoArgs
+}
+
+func (c *CachePrune) Run(_ *cobra.Command, _ []string) error {
+	if c.OlderThan == "" {
+		return fmt.Errorf("--older-than is required, use \"cache clear\" to remove all the entries")
+	}
+	olderThan, err := time.ParseDuration(c.OlderThan)
+	if err != nil || olderThan <= 0 {
+		return fmt.Errorf("invalid --older-than: %s", c.OlderThan)
+	}
+	return c.root.pruneCache(olderThan)
+}
+
+type CacheClear struct {
+	root *GPTScript
+}
+
+func (c *CacheClear) Customize(cmd *cobra.Command) {
+	cmd.Use = "clear"
+	cmd.Short = "Remove all the cache entries"
+	cmd.Args = cobra.NoArgs
+}
+
+func (c *CacheClear) Run(_ *cobra.Command, _ []string) error {
+	return c.root.pruneCache(0)
+}
+
+func (r *GPTScript) pruneCache(olderThan time.Duration) error {
+	client, err := cache.New(cache.Options(r.CacheOptions))
+	if err != nil {
+		return err
+	}
+
+	removed, err := client.Prune(olderThan)
+
+	var size int64
+	for _, entry := range removed {
+		size += entry.Size
+	}
+	fmt.Printf("Removed %d entries (%s)\n", len(removed), cache.FormatSize(size))
+	return err
+}
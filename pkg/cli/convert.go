@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/input"
+	"github.com/gptscript-ai/gptscript/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+type Convert struct {
+	From   string `usage:"Format of the input: gpt, yaml or json (default is from the name of the input file)"`
+	To     string `usage:"Format of the output: gpt, yaml or json (default is from the name of the output file, or yaml for .gpt input and gpt otherwise)"`
+	Output string `usage:"Write the output to this file instead of stdout" short:"o"`
+}
+
+func (c *Convert) Customize(cmd *cobra.Command) {
+	cmd.Use = "convert FILE"
+	cmd.Short = "Convert tools between the .gpt, YAML and JSON formats"
+	cmd.Args = cobra.ExactArgs(1)
+}
+
+func (c *Convert) Run(_ *cobra.Command, args []string) error {
+	input, err := input.FromFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	from := c.From
+	if from == "" {
+		from = parser.FormatOf(args[0])
+	}
+
+	to := c.To
+	if to == "" && c.Output != "" {
+		to = parser.FormatOf(c.Output)
+	} else if to == "" && from == parser.FormatGPT {
+		to = parser.FormatYAML
+	} else if to == "" {
+		to = parser.FormatGPT
+	}
+
+	doc, err := parser.ParseFormat(strings.NewReader(input), from, parser.Options{
+		Location: locationName(args[0]),
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := doc.Marshal(to)
+	if err != nil {
+		return err
+	}
+
+	if c.Output != "" {
+		return os.WriteFile(c.Output, data, 0644)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -8,44 +8,98 @@ import (
 
 	"github.com/gptscript-ai/gptscript/pkg/input"
 	"github.com/gptscript-ai/gptscript/pkg/parser"
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/spf13/cobra"
 )
 
 type Fmt struct {
 	Write bool `usage:"Write output to file instead of stdout" short:"w"`
+	Check bool `usage:"Print the diff of the files that are not formatted and exit with an error instead of formatting them"`
 }
 
 func (e *Fmt) Customize(cmd *cobra.Command) {
-	cmd.Args = cobra.ExactArgs(1)
+	cmd.Use = "fmt FILE..."
+	cmd.Short = "Format tool files, keeping their comments"
+	cmd.Args = cobra.MinimumNArgs(1)
 }
 
 func (e *Fmt) Run(_ *cobra.Command, args []string) error {
-	input, err := input.FromFile(args[0])
-	if err != nil {
-		return err
+	var unformatted []string
+	for _, file := range args {
+		input, err := input.FromFile(file)
+		if err != nil {
+			return err
+		}
+
+		output, err := format(file, input)
+		if err != nil {
+			return err
+		}
+
+		loc := locationName(file)
+		switch {
+		case e.Check:
+			if output != input {
+				unformatted = append(unformatted, file)
+				if err := printDiff(file, input, output); err != nil {
+					return err
+				}
+			}
+		case e.Write && loc != "":
+			if output != input {
+				if err := os.WriteFile(loc, []byte(output), 0644); err != nil {
+					return err
+				}
+			}
+		default:
+			fmt.Print(output)
+		}
 	}
 
+	if len(unformatted) > 0 {
+		return fmt.Errorf("%d files are not formatted: %s", len(unformatted), strings.Join(unformatted, ", "))
+	}
+	return nil
+}
+
+// format returns the formatted content of a file. A .gpt file may also hold the JSON of a parsed document.
+func format(file, input string) (string, error) {
 	var (
 		doc parser.Document
-		loc = locationName(args[0])
+		err error
+		f   = parser.FormatOf(file)
 	)
-	if strings.HasPrefix(input, "{") {
+	switch {
+	case f == parser.FormatMarkdown:
+		return "", fmt.Errorf("can not format %s, only the tools of markdown files are read", file)
+	case f == parser.FormatGPT && strings.HasPrefix(input, "{"):
 		if err := json.Unmarshal([]byte(input), &doc); err != nil {
-			return err
+			return "", err
 		}
-	} else {
-		doc, err = parser.Parse(strings.NewReader(input), parser.Options{
-			Location: locationName(args[0]),
+	default:
+		doc, err = parser.ParseFormat(strings.NewReader(input), f, parser.Options{
+			Location: locationName(file),
 		})
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
 
-	if e.Write && loc != "" {
-		return os.WriteFile(loc, []byte(doc.String()), 0644)
-	}
+	data, err := doc.Marshal(f)
+	return string(data), err
+}
 
-	fmt.Print(doc.String())
+func printDiff(file, input, output string) error {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(input),
+		B:        difflib.SplitLines(output),
+		FromFile: file,
+		ToFile:   file + " (formatted)",
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Print(diff)
 	return nil
 }
@@ -3,15 +3,18 @@ package cli
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/acorn-io/cmd"
 	"github.com/fatih/color"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
 	"github.com/gptscript-ai/gptscript/pkg/assemble"
 	"github.com/gptscript-ai/gptscript/pkg/builtin"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
@@ -23,6 +26,7 @@ import (
 	"github.com/gptscript-ai/gptscript/pkg/monitor"
 	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/gptscript-ai/gptscript/pkg/openai"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
 	"github.com/gptscript-ai/gptscript/pkg/server"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/gptscript-ai/gptscript/pkg/version"
@@ -32,36 +36,49 @@ import (
 )
 
 type (
-	DisplayOptions monitor.Options
-	CacheOptions   cache.Options
-	OpenAIOptions  openai.Options
+	DisplayOptions   monitor.Options
+	CacheOptions     cache.Options
+	OpenAIOptions    openai.Options
+	AnthropicOptions anthropic.Options
 )
 
 type GPTScript struct {
 	CacheOptions
 	OpenAIOptions
+	AnthropicOptions
 	DisplayOptions
-	Color              *bool  `usage:"Use color in output (default true)" default:"true"`
-	Confirm            bool   `usage:"Prompt before running potentially dangerous commands"`
-	Debug              bool   `usage:"Enable debug logging"`
-	Quiet              *bool  `usage:"No output logging (set --quiet=false to force on even when there is no TTY)" short:"q"`
-	Output             string `usage:"Save output to a file, or - for stdout" short:"o"`
-	EventsStreamTo     string `usage:"Stream events to this location, could be a file descriptor/handle (e.g. fd://2), filename, or named pipe (e.g. \\\\.\\pipe\\my-pipe)" name:"events-stream-to"`
-	Input              string `usage:"Read input from a file (\"-\" for stdin)" short:"f"`
-	SubTool            string `usage:"Use tool of this name, not the first tool in file" local:"true"`
-	Assemble           bool   `usage:"Assemble tool to a single artifact, saved to --output" hidden:"true" local:"true"`
-	ListModels         bool   `usage:"List the models available and exit" local:"true"`
-	ListTools          bool   `usage:"List built-in tools and exit" local:"true"`
-	Server             bool   `usage:"Start server" local:"true"`
-	ListenAddress      string `usage:"Server listen address" default:"127.0.0.1:9090" local:"true"`
-	Chdir              string `usage:"Change current working directory" short:"C"`
-	Daemon             bool   `usage:"Run tool as a daemon" local:"true" hidden:"true"`
-	Ports              string `usage:"The port range to use for ephemeral daemon ports (ex: 11000-12000)" hidden:"true"`
-	CredentialContext  string `usage:"Context name in which to store credentials" default:"default"`
-	CredentialOverride string `usage:"Credentials to override (ex: --credential-override github.com/example/cred-tool:API_TOKEN=1234)"`
-	ChatState          string `usage:"The chat state to continue, or null to start a new chat and return the state"`
-	ForceChat          bool   `usage:"Force an interactive chat session if even the top level tool is not a chat tool"`
-	Workspace          string `usage:"Directory to use for the workspace, if specified it will not be deleted on exit"`
+	Color              *bool    `usage:"Use color in output (default true)" default:"true"`
+	Confirm            bool     `usage:"Prompt before running potentially dangerous commands"`
+	Debug              bool     `usage:"Enable debug logging"`
+	Quiet              *bool    `usage:"No output logging (set --quiet=false to force on even when there is no TTY)" short:"q"`
+	Output             string   `usage:"Save output to a file, or - for stdout" short:"o"`
+	EventsStreamTo     string   `usage:"Stream events to this location, could be a file descriptor/handle (e.g. fd://2), filename, or named pipe (e.g. \\\\.\\pipe\\my-pipe)" name:"events-stream-to"`
+	Input              string   `usage:"Read input from a file (\"-\" for stdin)" short:"f"`
+	Image              []string `usage:"Image file or data URL to send with the input to vision models, can be repeated"`
+	SubTool            string   `usage:"Use tool of this name, not the first tool in file" local:"true"`
+	Assemble           bool     `usage:"Assemble tool to a single artifact, saved to --output" hidden:"true" local:"true"`
+	ListModels         bool     `usage:"List the models available and exit" local:"true"`
+	ListTools          bool     `usage:"List built-in tools and exit" local:"true"`
+	Server             bool     `usage:"Start server" local:"true"`
+	ListenAddress      string   `usage:"Server listen address" default:"127.0.0.1:9090" local:"true"`
+	Chdir              string   `usage:"Change current working directory" short:"C"`
+	Daemon             bool     `usage:"Run tool as a daemon" local:"true" hidden:"true"`
+	Ports              string   `usage:"The port range to use for ephemeral daemon ports (ex: 11000-12000)" hidden:"true"`
+	CredentialContext  string   `usage:"Context name in which to store credentials" default:"default"`
+	CredentialOverride string   `usage:"Credentials to override (ex: --credential-override github.com/example/cred-tool:API_TOKEN=1234)"`
+	ChatState          string   `usage:"The chat state to continue, or null to start a new chat and return the state"`
+	ForceChat          bool     `usage:"Force an interactive chat session if even the top level tool is not a chat tool"`
+	Workspace          string   `usage:"Directory to use for the workspace, if specified it will not be deleted on exit"`
+	MaxTokensTotal     int64    `usage:"Stop the run once it has used more than this many tokens in total"`
+	MaxCost            string   `usage:"Stop the run once its estimated cost in USD is more than this amount (ex: --max-cost 2.50)"`
+	PriceTable         string   `usage:"JSON file of model prices in USD per million tokens, used with --max-cost"`
+	ContextStrategy    string   `usage:"How to shrink conversations that outgrow the model's context window (drop-oldest-tool-results or summarize-with-model)" default:"drop-oldest-tool-results"`
+	MaxConcurrency     int64    `usage:"Maximum number of tool calls of a run that can run at the same time (default unlimited)"`
+	MaxTurns           int      `usage:"Maximum number of turns of a tool's model before it stops calling tools, for tools without Max Turns (default unlimited)"`
+	MaxTurnsAction     string   `usage:"What to do when a tool reaches its maximum number of turns (error or wrap-up)" default:"error"`
+	Timeout            string   `usage:"Timeout of each command and LLM call of tools without a Timeout (ex: --timeout 5m) (default none)"`
+	Record             string   `usage:"Save every LLM completion as a fixture in this directory"`
+	Replay             string   `usage:"Answer LLM completions only from the fixtures recorded in this directory, without calling any model"`
 
 	readData []byte
 }
@@ -74,8 +91,12 @@ func New() *cobra.Command {
 			gptscript: root,
 		},
 		&Credential{root: root},
+		&Cache{root: root},
 		&Parse{},
 		&Fmt{},
+		&Convert{},
+		&LSP{},
+		&Lint{},
 	)
 
 	// Hide all the global flags for the credential subcommand.
@@ -126,8 +147,11 @@ func (r *GPTScript) NewGPTScriptOpts() (gptscript.Options, error) {
 	opts := gptscript.Options{
 		Cache:             cache.Options(r.CacheOptions),
 		OpenAI:            openai.Options(r.OpenAIOptions),
+		Anthropic:         anthropic.Options(r.AnthropicOptions),
 		Monitor:           monitor.Options(r.DisplayOptions),
 		Quiet:             r.Quiet,
+		Record:            r.Record,
+		Replay:            r.Replay,
 		Env:               os.Environ(),
 		CredentialContext: r.CredentialContext,
 		Workspace:         r.Workspace,
@@ -151,6 +175,35 @@ func (r *GPTScript) NewGPTScriptOpts() (gptscript.Options, error) {
 	}
 
 	opts.Runner.CredentialOverride = r.CredentialOverride
+	opts.Runner.MaxTokensTotal = r.MaxTokensTotal
+	opts.Runner.ContextStrategy = r.ContextStrategy
+	opts.Runner.MaxConcurrency = r.MaxConcurrency
+	opts.Runner.MaxTurns = r.MaxTurns
+	opts.Runner.MaxTurnsAction = r.MaxTurnsAction
+
+	if r.Timeout != "" {
+		timeout, err := time.ParseDuration(r.Timeout)
+		if err != nil {
+			return gptscript.Options{}, fmt.Errorf("invalid timeout: %s", r.Timeout)
+		}
+		opts.Runner.Timeout = timeout
+	}
+
+	if r.MaxCost != "" {
+		maxCost, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(r.MaxCost), "$"), 64)
+		if err != nil || maxCost < 0 {
+			return gptscript.Options{}, fmt.Errorf("invalid max cost: %s", r.MaxCost)
+		}
+		opts.Runner.MaxCost = maxCost
+	}
+
+	if r.PriceTable != "" {
+		prices, err := runner.ReadPriceTable(r.PriceTable)
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.Runner.Prices = prices
+	}
 
 	if r.EventsStreamTo != "" {
 		mf, err := monitor.NewFileFactory(r.EventsStreamTo)
@@ -307,7 +360,37 @@ func (r *GPTScript) PrintOutput(toolInput, toolOutput string) (err error) {
 	return
 }
 
+// dumpBudgetState writes the state of a run that was stopped by a budget to a file so the work done
+// so far is not lost.
+func (r *GPTScript) dumpBudgetState(budgetErr *runner.ErrBudgetExceeded) {
+	data, err := json.MarshalIndent(budgetErr, "", "  ")
+	if err != nil {
+		log.Errorf("failed to marshal partial state: %v", err)
+		return
+	}
+
+	f, err := os.CreateTemp("", version.ProgramName+"-state-*.json")
+	if err != nil {
+		log.Errorf("failed to write partial state: %v", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		log.Errorf("failed to write partial state: %v", err)
+		return
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "%v, partial state written to %s (usage: %s, estimated cost: $%.4f)\n", budgetErr, f.Name(), budgetErr.Usage, budgetErr.Cost)
+}
+
 func (r *GPTScript) Run(cmd *cobra.Command, args []string) (retErr error) {
+	defer func() {
+		if budgetErr := (*runner.ErrBudgetExceeded)(nil); errors.As(retErr, &budgetErr) {
+			r.dumpBudgetState(budgetErr)
+		}
+	}()
+
 	gptOpt, err := r.NewGPTScriptOpts()
 	if err != nil {
 		return err
@@ -378,6 +461,11 @@ func (r *GPTScript) Run(cmd *cobra.Command, args []string) (retErr error) {
 		return err
 	}
 
+	toolInput, err = input.WithImages(toolInput, r.Image)
+	if err != nil {
+		return err
+	}
+
 	if r.ChatState != "" {
 		resp, err := gptScript.Chat(r.NewRunContext(cmd), r.ChatState, prg, os.Environ(), toolInput)
 		if err != nil {
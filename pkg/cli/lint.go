@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gptscript-ai/gptscript/pkg/lint"
+	"github.com/spf13/cobra"
+)
+
+type Lint struct {
+	PrettyPrint bool `usage:"Indent the json output" short:"p"`
+}
+
+func (l *Lint) Customize(cmd *cobra.Command) {
+	cmd.Use = "lint FILE"
+	cmd.Short = "Report the problems of a program without running it, as JSON"
+	cmd.Args = cobra.ExactArgs(1)
+}
+
+func (l *Lint) Run(cmd *cobra.Command, args []string) error {
+	problems, err := lint.File(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+	if problems == nil {
+		problems = []lint.Problem{}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	if l.PrettyPrint {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(map[string]any{
+		"problems": problems,
+	}); err != nil {
+		return err
+	}
+
+	if errs := lint.Errors(problems); errs > 0 {
+		return fmt.Errorf("found %d errors in %s", errs, args[0])
+	}
+	return nil
+}
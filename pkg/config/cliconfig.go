@@ -48,11 +48,39 @@ type CLIConfig struct {
 	Auths               map[string]AuthConfig `json:"auths,omitempty"`
 	CredentialsStore    string                `json:"credsStore,omitempty"`
 	GPTScriptConfigFile string                `json:"gptscriptConfig,omitempty"`
+	// ModelFallbacks are the models to fall back to for tools that do not declare their own
+	ModelFallbacks []string `json:"modelFallbacks,omitempty"`
+	// Models are model aliases that tools can use as their model name
+	Models map[string]ModelConfig `json:"models,omitempty"`
+	// ModelProviders maps model names to the provider serving them, openai or anthropic, so that the
+	// providers are not asked for their models
+	ModelProviders map[string]string `json:"modelProviders,omitempty"`
 
 	auths     map[string]types.AuthConfig
 	authsLock *sync.Mutex
 }
 
+// ModelConfig is a named model alias. A tool with "Model: fast" uses the alias named fast, so the model,
+// provider and default parameters can be changed for all tools in one place.
+type ModelConfig struct {
+	// Model is the name of the model, "model from provider" for a remote provider
+	Model string `json:"model"`
+	// BaseURL is the URL of an OpenAI compatible API to use instead of the default providers
+	BaseURL    string `json:"baseURL,omitempty"`
+	APIType    string `json:"apiType,omitempty"`
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Deployment is the Azure deployment of the model
+	Deployment string `json:"deployment,omitempty"`
+	// APIKeyEnv is the environment variable that has the API key for BaseURL
+	APIKeyEnv string `json:"apiKeyEnv,omitempty"`
+	// Credential is a credential tool that sets APIKeyEnv
+	Credential string `json:"credential,omitempty"`
+	// Grammar sends output schemas as a grammar, for servers without the json_schema response format
+	Grammar     bool     `json:"grammar,omitempty"`
+	MaxTokens   int      `json:"maxTokens,omitempty"`
+	Temperature *float32 `json:"temperature,omitempty"`
+}
+
 func (c *CLIConfig) Sanitize() *CLIConfig {
 	if c == nil {
 		return nil
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+var argRefRegex = regexp.MustCompile(`\$?\$\{([^{}]+)\}`)
+
+// expandArgs replaces ${arg} in the instructions of a tool with the value of the argument in input. Only the
+// arguments the tool declares are replaced, missing arguments are replaced with nothing, and $${arg} is
+// replaced with ${arg}.
+func expandArgs(tool types.Tool, input string) string {
+	if tool.Arguments == nil || !strings.Contains(tool.Instructions, "${") {
+		return tool.Instructions
+	}
+
+	args := inputArgs(input)
+	return argRefRegex.ReplaceAllStringFunc(tool.Instructions, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		name := ref[2 : len(ref)-1]
+		if _, ok := tool.Arguments.Properties[name]; !ok {
+			return ref
+		}
+		return args[name]
+	})
+}
+
+// ApplyArgDefaults adds the default values of the arguments of a tool that are missing from a JSON object
+// input. Only objects of the arguments the tool declares are changed, so plain text, image envelopes and other
+// JSON are returned as is, as is empty input for chat tools.
+func ApplyArgDefaults(tool types.Tool, input string) string {
+	if tool.Arguments == nil || (input == "" && tool.Chat) {
+		return input
+	}
+
+	var defaults bool
+	for _, prop := range tool.Arguments.Properties {
+		if prop.Value != nil && prop.Value.Default != nil {
+			defaults = true
+			break
+		}
+	}
+	if !defaults || isImageInput(input) {
+		return input
+	}
+
+	args := map[string]any{}
+	if strings.TrimSpace(input) != "" {
+		dec := json.NewDecoder(strings.NewReader(input))
+		dec.UseNumber()
+		if err := dec.Decode(&args); err != nil {
+			return input
+		}
+	}
+
+	for name := range args {
+		if _, ok := tool.Arguments.Properties[name]; !ok {
+			return input
+		}
+	}
+
+	var added bool
+	for name, prop := range tool.Arguments.Properties {
+		if _, ok := args[name]; !ok && prop.Value != nil && prop.Value.Default != nil {
+			args[name] = prop.Value.Default
+			added = true
+		}
+	}
+	if !added {
+		return input
+	}
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		return input
+	}
+	return string(data)
+}
+
+func isImageInput(input string) bool {
+	for _, part := range types.Content(input) {
+		if part.Image != nil {
+			return true
+		}
+	}
+	return false
+}
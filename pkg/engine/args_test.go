@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandArgs(t *testing.T) {
+	tool := types.Tool{
+		Parameters: types.Parameters{
+			Arguments: &openapi3.Schema{
+				Type: "object",
+				Properties: openapi3.Schemas{
+					"name":  openapi3.NewStringSchema().NewRef(),
+					"count": openapi3.NewIntegerSchema().NewRef(),
+					"tags":  openapi3.NewArraySchema().NewRef(),
+					"other": openapi3.NewStringSchema().NewRef(),
+				},
+			},
+		},
+	}
+	input := `{"name": "Bob", "count": 3, "tags": ["a", "b"]}`
+
+	for instructions, expected := range map[string]string{
+		"Greet ${name} ${count} times":     "Greet Bob 3 times",
+		"Use the tags ${tags}":             `Use the tags ["a","b"]`,
+		"Missing arguments are [${other}]": "Missing arguments are []",
+		"Undeclared ${unknown} stays":      "Undeclared ${unknown} stays",
+		"Escaped $${name} is literal":      "Escaped ${name} is literal",
+		"Plain $name and $5 are not args":  "Plain $name and $5 are not args",
+	} {
+		tool.Instructions = instructions
+		assert.Equal(t, expected, expandArgs(tool, input), instructions)
+	}
+
+	tool.Instructions = "Greet ${name}"
+	assert.Equal(t, "Greet ", expandArgs(tool, "not json"))
+
+	tool.Arguments = nil
+	assert.Equal(t, "Greet ${name}", expandArgs(tool, input))
+}
+
+func TestApplyArgDefaults(t *testing.T) {
+	count := openapi3.NewIntegerSchema()
+	count.Default = 3
+	tool := types.Tool{
+		Parameters: types.Parameters{
+			Arguments: &openapi3.Schema{
+				Type: "object",
+				Properties: openapi3.Schemas{
+					"name":  openapi3.NewStringSchema().NewRef(),
+					"count": count.NewRef(),
+					"size":  openapi3.NewIntegerSchema().NewRef(),
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, `{"count":3}`, ApplyArgDefaults(tool, ""))
+	assert.Equal(t, `{"count":3,"name":"Bob"}`, ApplyArgDefaults(tool, `{"name": "Bob"}`))
+	assert.Equal(t, `{"count":3,"size":12345678901}`, ApplyArgDefaults(tool, `{"size": 12345678901}`))
+	assert.Equal(t, "plain text", ApplyArgDefaults(tool, "plain text"))
+
+	// Input that is not an object of the arguments of the tool is left as is
+	image := `{"type": "image", "url": "https://example.com/a.png"}`
+	assert.Equal(t, image, ApplyArgDefaults(tool, image))
+	assert.Equal(t, `{"other": true}`, ApplyArgDefaults(tool, `{"other": true}`))
+	assert.Equal(t, `{"name": "Bob", "count": 1}`, ApplyArgDefaults(tool, `{"name": "Bob", "count": 1}`))
+
+	tool.Chat = true
+	assert.Equal(t, "", ApplyArgDefaults(tool, ""))
+}
+
+func TestInputArgsKeepsNumbers(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"big":   "12345678901",
+		"ratio": "0.5",
+		"loud":  "true",
+	}, inputArgs(`{"big": 12345678901, "ratio": 0.5, "loud": true}`))
+}
@@ -13,6 +13,7 @@ import (
 	"sort"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/shlex"
 	context2 "github.com/gptscript-ai/gptscript/pkg/context"
@@ -64,6 +65,8 @@ func (e *Engine) runCommand(ctx context.Context, tool types.Tool, input string,
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = io.MultiWriter(all, os.Stderr)
 	cmd.Stdout = io.MultiWriter(all, output)
+	// Don't wait forever on the output of processes started by the command once it is killed
+	cmd.WaitDelay = time.Second
 
 	if toolCategory == CredentialToolCategory {
 		pause := context2.GetPauseFuncFromCtx(ctx)
@@ -127,33 +130,45 @@ func appendEnv(envs []string, k, v string) []string {
 	return envs
 }
 
-func appendInputAsEnv(env []string, input string) []string {
+// inputArgs returns the arguments of a JSON input as strings, objects and arrays as JSON.
+func inputArgs(input string) map[string]string {
 	data := map[string]any{}
 	dec := json.NewDecoder(bytes.NewReader([]byte(input)))
 	dec.UseNumber()
 
-	if err := json.Unmarshal([]byte(input), &data); err != nil {
+	if err := dec.Decode(&data); err != nil {
 		// ignore invalid JSON
-		return env
+		return nil
 	}
 
+	result := map[string]string{}
 	for k, v := range data {
 		switch val := v.(type) {
 		case string:
-			env = appendEnv(env, k, val)
+			result[k] = val
 		case json.Number:
-			env = appendEnv(env, k, string(val))
+			result[k] = string(val)
 		case bool:
-			env = appendEnv(env, k, fmt.Sprint(val))
+			result[k] = fmt.Sprint(val)
 		default:
 			data, err := json.Marshal(val)
 			if err == nil {
-				env = appendEnv(env, k, string(data))
+				result[k] = string(data)
 			}
 		}
 	}
+	return result
+}
+
+func appendInputAsEnv(env []string, input string) []string {
+	for k, v := range inputArgs(input) {
+		env = appendEnv(env, k, v)
+	}
 
-	env = appendEnv(env, "GPTSCRIPT_INPUT", input)
+	// Plain text input, like the output of the previous tool of a sys.sequence, is only passed as is
+	if input != "" {
+		env = appendEnv(env, "GPTSCRIPT_INPUT", input)
+	}
 	return env
 }
 
@@ -93,7 +93,7 @@ func getPath(instructions string) (string, string) {
 	return strings.TrimSpace(rest), strings.TrimSpace(value)
 }
 
-func (e *Engine) startDaemon(_ context.Context, tool types.Tool) (string, error) {
+func (e *Engine) startDaemon(callCtx context.Context, tool types.Tool) (string, error) {
 	e.Ports.daemonLock.Lock()
 	defer e.Ports.daemonLock.Unlock()
 
@@ -188,6 +188,8 @@ func (e *Engine) startDaemon(_ context.Context, tool types.Tool) (string, error)
 		select {
 		case <-killedCtx.Done():
 			return url, fmt.Errorf("daemon failed to start: %w", context.Cause(killedCtx))
+		case <-callCtx.Done():
+			return url, fmt.Errorf("daemon did not start: %w", callCtx.Err())
 		case <-time.After(time.Second):
 		}
 	}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/gptscript-ai/gptscript/pkg/system"
 	"github.com/gptscript-ai/gptscript/pkg/types"
@@ -24,11 +25,14 @@ type RuntimeManager interface {
 }
 
 type Engine struct {
-	Model          Model
-	RuntimeManager RuntimeManager
-	Env            []string
-	Progress       chan<- types.CompletionStatus
-	Ports          *Ports
+	Model           Model
+	RuntimeManager  RuntimeManager
+	Env             []string
+	Progress        chan<- types.CompletionStatus
+	Ports           *Ports
+	ContextStrategy ContextStrategy
+	// Timeout is the default timeout of commands and LLM calls of tools without their own
+	Timeout time.Duration
 }
 
 type State struct {
@@ -36,6 +40,16 @@ type State struct {
 	Completion types.CompletionRequest             `json:"completion,omitempty"`
 	Pending    map[string]types.CompletionToolCall `json:"pending,omitempty"`
 	Results    map[string]CallResult               `json:"results,omitempty"`
+	// OriginalMessages is the full history of messages once Completion.Messages has been reduced to fit the
+	// context window.
+	OriginalMessages []types.CompletionMessage `json:"originalMessages,omitempty"`
+}
+
+func (s *State) addMessages(msgs ...types.CompletionMessage) {
+	s.Completion.Messages = append(s.Completion.Messages, msgs...)
+	if s.OriginalMessages != nil {
+		s.OriginalMessages = append(s.OriginalMessages, msgs...)
+	}
 }
 
 type Return struct {
@@ -75,6 +89,12 @@ type Context struct {
 	Parent       *Context
 	Program      *types.Program
 	ToolCategory ToolCategory
+	usage        *usageTracker
+}
+
+type usageTracker struct {
+	lock  sync.Mutex
+	usage types.Usage
 }
 
 type ToolCategory string
@@ -97,6 +117,29 @@ func (c *Context) ParentID() string {
 	return c.Parent.ID
 }
 
+// AddUsage records the usage of a completion made by this call. The usage is rolled up into all
+// the parent calls so that each call reports the usage of its whole call tree.
+func (c *Context) AddUsage(usage types.Usage) {
+	for cur := c; cur != nil; cur = cur.Parent {
+		if cur.usage == nil {
+			continue
+		}
+		cur.usage.lock.Lock()
+		cur.usage.usage = cur.usage.usage.Add(usage)
+		cur.usage.lock.Unlock()
+	}
+}
+
+// Usage returns the usage of this call and all of its sub calls.
+func (c *Context) Usage() types.Usage {
+	if c.usage == nil {
+		return types.Usage{}
+	}
+	c.usage.lock.Lock()
+	defer c.usage.lock.Unlock()
+	return c.usage.usage
+}
+
 func (c *Context) GetCallContext() *CallContext {
 	var toolName string
 	if c.Parent != nil {
@@ -133,6 +176,7 @@ func NewContext(ctx context.Context, prg *types.Program) Context {
 		},
 		Ctx:     ctx,
 		Program: prg,
+		usage:   &usageTracker{},
 	}
 	return callCtx
 }
@@ -156,6 +200,7 @@ func (c *Context) SubCall(ctx context.Context, toolID, callID string, toolCatego
 		Ctx:     ctx,
 		Parent:  c,
 		Program: c.Program,
+		usage:   &usageTracker{},
 	}, nil
 }
 
@@ -172,6 +217,7 @@ func (c *Context) WrappedContext() context.Context {
 
 func (e *Engine) Start(ctx Context, input string) (ret *Return, _ error) {
 	tool := ctx.Tool
+	input = ApplyArgDefaults(tool, input)
 
 	defer func() {
 		if ret != nil && ret.State != nil {
@@ -180,22 +226,10 @@ func (e *Engine) Start(ctx Context, input string) (ret *Return, _ error) {
 	}()
 
 	if tool.IsCommand() {
-		if tool.IsHTTP() {
-			return e.runHTTP(ctx.Ctx, ctx.Program, tool, input)
-		} else if tool.IsDaemon() {
-			return e.runDaemon(ctx.Ctx, ctx.Program, tool, input)
-		} else if tool.IsOpenAPI() {
-			return e.runOpenAPI(tool, input)
-		} else if tool.IsPrint() {
-			return e.runPrint(tool)
-		}
-		s, err := e.runCommand(ctx.WrappedContext(), tool, input, ctx.ToolCategory)
-		if err != nil {
-			return nil, err
-		}
-		return &Return{
-			Result: &s,
-		}, nil
+		timeoutCtx, cancel := e.withTimeout(ctx)
+		defer cancel()
+		ret, err := e.runCommandTool(timeoutCtx, input)
+		return ret, e.timeoutError(ctx, timeoutCtx, err)
 	}
 
 	if ctx.ToolCategory == CredentialToolCategory {
@@ -204,8 +238,10 @@ func (e *Engine) Start(ctx Context, input string) (ret *Return, _ error) {
 
 	completion := types.CompletionRequest{
 		Model:                tool.Parameters.ModelName,
+		ModelFallbacks:       tool.Parameters.ModelFallbacks,
 		MaxTokens:            tool.Parameters.MaxTokens,
 		JSONResponse:         tool.Parameters.JSONResponse,
+		OutputSchema:         tool.Parameters.OutputSchema,
 		Cache:                tool.Parameters.Cache,
 		Temperature:          tool.Parameters.Temperature,
 		InternalSystemPrompt: tool.Parameters.InternalPrompt,
@@ -221,6 +257,7 @@ func (e *Engine) Start(ctx Context, input string) (ret *Return, _ error) {
 		return nil, err
 	}
 
+	tool.Instructions = expandArgs(tool, input)
 	completion.Messages = addUpdateSystem(ctx, tool, completion.Messages)
 
 	if _, def := system.IsDefaultPrompt(input); tool.Chat && def {
@@ -231,13 +268,41 @@ func (e *Engine) Start(ctx Context, input string) (ret *Return, _ error) {
 	if input != "" {
 		completion.Messages = append(completion.Messages, types.CompletionMessage{
 			Role:    types.CompletionMessageRoleTypeUser,
-			Content: types.Text(input),
+			Content: types.Content(input),
 		})
 	}
 
-	return e.complete(ctx.Ctx, &State{
+	state := &State{
 		Completion: completion,
-	})
+	}
+
+	if err := e.fitContext(ctx, state); err != nil {
+		return nil, err
+	}
+
+	return e.complete(ctx, state)
+}
+
+func (e *Engine) runCommandTool(ctx Context, input string) (*Return, error) {
+	tool := ctx.Tool
+	if tool.IsHTTP() {
+		return e.runHTTP(ctx.Ctx, ctx.Program, tool, input)
+	} else if tool.IsDaemon() {
+		return e.runDaemon(ctx.Ctx, ctx.Program, tool, input)
+	} else if tool.IsOpenAPI() {
+		return e.runOpenAPI(ctx.Ctx, tool, input)
+	} else if tool.IsPrint() {
+		return e.runPrint(tool)
+	} else if tool.IsTemplate() {
+		return e.runTemplate(tool, input)
+	}
+	s, err := e.runCommand(ctx.WrappedContext(), tool, input, ctx.ToolCategory)
+	if err != nil {
+		return nil, err
+	}
+	return &Return{
+		Result: &s,
+	}, nil
 }
 
 func addUpdateSystem(ctx Context, tool types.Tool, msgs []types.CompletionMessage) []types.CompletionMessage {
@@ -267,21 +332,15 @@ func addUpdateSystem(ctx Context, tool types.Tool, msgs []types.CompletionMessag
 	return append([]types.CompletionMessage{msg}, msgs...)
 }
 
-func (e *Engine) complete(ctx context.Context, state *State) (*Return, error) {
+// forwardProgress returns a channel that forwards to e.Progress and a func that closes it once nothing
+// is writing to it anymore.
+func (e *Engine) forwardProgress() (chan<- types.CompletionStatus, func()) {
 	var (
 		progress = make(chan types.CompletionStatus)
-		ret      = Return{
-			State: state,
-			Calls: map[string]Call{},
-		}
-		wg sync.WaitGroup
+		wg       sync.WaitGroup
 	)
 
-	// ensure we aren't writing to the channel anymore on exit
 	wg.Add(1)
-	defer wg.Wait()
-	defer close(progress)
-
 	go func() {
 		defer wg.Done()
 		for message := range progress {
@@ -291,12 +350,31 @@ func (e *Engine) complete(ctx context.Context, state *State) (*Return, error) {
 		}
 	}()
 
-	resp, err := e.Model.Call(ctx, state.Completion, progress)
+	return progress, func() {
+		close(progress)
+		wg.Wait()
+	}
+}
+
+func (e *Engine) complete(ctx Context, state *State) (*Return, error) {
+	ret := Return{
+		State: state,
+		Calls: map[string]Call{},
+	}
+
+	progress, closeProgress := e.forwardProgress()
+	// ensure we aren't writing to the channel anymore on exit
+	defer closeProgress()
+
+	timeoutCtx, cancel := e.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := e.Model.Call(timeoutCtx.Ctx, state.Completion, progress)
 	if err != nil {
-		return nil, err
+		return nil, e.timeoutError(ctx, timeoutCtx, err)
 	}
 
-	state.Completion.Messages = append(state.Completion.Messages, *resp)
+	state.addMessages(*resp)
 
 	state.Pending = map[string]types.CompletionToolCall{}
 	for _, content := range resp.Content {
@@ -334,18 +412,19 @@ func (e *Engine) Continue(ctx Context, state *State, results ...CallResult) (*Re
 	var added bool
 
 	state = &State{
-		Input:      state.Input,
-		Completion: state.Completion,
-		Pending:    state.Pending,
-		Results:    map[string]CallResult{},
+		Input:            state.Input,
+		Completion:       state.Completion,
+		Pending:          state.Pending,
+		Results:          map[string]CallResult{},
+		OriginalMessages: state.OriginalMessages,
 	}
 
 	for _, result := range results {
 		if result.CallID == "" {
 			added = true
-			state.Completion.Messages = append(state.Completion.Messages, types.CompletionMessage{
+			state.addMessages(types.CompletionMessage{
 				Role:    types.CompletionMessageRoleTypeUser,
-				Content: types.Text(result.User),
+				Content: types.Content(result.User),
 			})
 		} else {
 			state.Results[result.CallID] = result
@@ -388,9 +467,9 @@ func (e *Engine) Continue(ctx Context, state *State, results ...CallResult) (*Re
 		}
 
 		added = true
-		state.Completion.Messages = append(state.Completion.Messages, types.CompletionMessage{
+		state.addMessages(types.CompletionMessage{
 			Role:     types.CompletionMessageRoleTypeTool,
-			Content:  types.Text(result.Result),
+			Content:  types.Content(result.Result),
 			ToolCall: &pending,
 		})
 	}
@@ -399,6 +478,16 @@ func (e *Engine) Continue(ctx Context, state *State, results ...CallResult) (*Re
 		return nil, fmt.Errorf("invalid continue call, no completion needed")
 	}
 
-	state.Completion.Messages = addUpdateSystem(ctx, ctx.Tool, state.Completion.Messages)
-	return e.complete(ctx.Ctx, state)
+	tool := ctx.Tool
+	tool.Instructions = expandArgs(tool, state.Input)
+	state.Completion.Messages = addUpdateSystem(ctx, tool, state.Completion.Messages)
+	if state.OriginalMessages != nil {
+		state.OriginalMessages = addUpdateSystem(ctx, tool, state.OriginalMessages)
+	}
+
+	if err := e.fitContext(ctx, state); err != nil {
+		return nil, err
+	}
+
+	return e.complete(ctx, state)
 }
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -51,7 +52,7 @@ type OpenAPIInstructions struct {
 // The tool itself will have instructions regarding the HTTP request that needs to be made.
 // The tools Instructions field will be in the format "#!sys.openapi '{Instructions JSON}'",
 // where {Instructions JSON} is a JSON string of type OpenAPIInstructions.
-func (e *Engine) runOpenAPI(tool types.Tool, input string) (*Return, error) {
+func (e *Engine) runOpenAPI(ctx context.Context, tool types.Tool, input string) (*Return, error) {
 	envMap := map[string]string{}
 
 	for _, env := range e.Env {
@@ -78,7 +79,7 @@ func (e *Engine) runOpenAPI(tool types.Tool, input string) (*Return, error) {
 	}
 
 	// Set up the request
-	req, err := http.NewRequest(instructions.Method, u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, instructions.Method, u.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/gptscript-ai/gptscript/pkg/parser"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// templateErrRegex matches the errors of text/template, as in "template: name:3:5: executing ..."
+var templateErrRegex = regexp.MustCompile(`^template: [^:]*:(\d+)(?::\d+)?: (.*)$`)
+
+var templateFuncs = template.FuncMap{
+	"json":    templateJSON,
+	"upper":   strings.ToUpper,
+	"join":    templateJoin,
+	"default": templateDefault,
+}
+
+// runTemplate renders the instructions after the first line of a sys.template tool as a Go text/template. The
+// arguments of the input are the data of the template and the environment of the tool is .env.
+func (e *Engine) runTemplate(tool types.Tool, input string) (*Return, error) {
+	_, body, _ := strings.Cut(tool.Instructions, "\n")
+
+	tmpl, err := template.New("template").Funcs(templateFuncs).Parse(body)
+	if err != nil {
+		return nil, templateError(tool, err)
+	}
+
+	data := map[string]any{}
+	if strings.TrimSpace(input) != "" {
+		dec := json.NewDecoder(strings.NewReader(input))
+		dec.UseNumber()
+		// plain text input has no arguments
+		_ = dec.Decode(&data)
+	}
+	_, data["env"] = envAsMapAndDeDup(e.Env)
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, templateError(tool, err)
+	}
+	out := buf.String()
+
+	id := fmt.Sprint(atomic.AddInt64(&completionID, 1))
+	e.Progress <- types.CompletionStatus{
+		CompletionID: id,
+		Response: map[string]any{
+			"output": out,
+			"err":    nil,
+		},
+	}
+
+	return &Return{
+		Result: &out,
+	}, nil
+}
+
+// templateError converts the line of an error of text/template to the line of the source of the tool.
+func templateError(tool types.Tool, err error) error {
+	match := templateErrRegex.FindStringSubmatch(err.Error())
+	if match == nil {
+		return fmt.Errorf("failed to render template of tool [%s]: %w", tool.Name, err)
+	}
+
+	line, _ := strconv.Atoi(match[1])
+	if tool.Source.BodyLineNo > 0 {
+		// The template starts on the line after the #!sys.template line
+		line += tool.Source.BodyLineNo
+	}
+	return fmt.Errorf("failed to render template of tool [%s]: %w", tool.Name,
+		parser.NewErrLine(tool.Source.Location, line, errors.New(match[2])))
+}
+
+func templateJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// templateJoin joins the items of a list with sep, as in {{ join ", " .items }}.
+func templateJoin(sep string, v any) string {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return fmt.Sprint(v)
+	}
+
+	items := make([]string, 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		items = append(items, fmt.Sprint(value.Index(i).Interface()))
+	}
+	return strings.Join(items, sep)
+}
+
+// templateDefault returns v, or def if v is missing or empty, as in {{ default "world" .name }}.
+func templateDefault(def, v any) any {
+	if v == nil {
+		return def
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		if value.Len() == 0 {
+			return def
+		}
+	default:
+		if value.IsZero() {
+			return def
+		}
+	}
+	return v
+}
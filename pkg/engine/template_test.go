@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/parser"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunTemplate(t *testing.T) {
+	e := &Engine{
+		Env:      []string{"GREETING=Hello"},
+		Progress: make(chan types.CompletionStatus, 10),
+	}
+
+	for body, expected := range map[string]string{
+		"{{ .env.GREETING }} {{ upper .name }}":    "Hello BOB",
+		"{{ .count }} {{ join \", \" .tags }}":     "3 a, b",
+		"{{ json .tags }}":                         `["a","b"]`,
+		"{{ default \"none\" .missing }}":          "none",
+		"{{ default \"none\" .name }}":             "Bob",
+		"{{ range .tags }}[{{ . }}]{{ end }}":      "[a][b]",
+		"{{ if .name }}named{{ else }}{{ end }}":   "named",
+		"{{ default \"none\" .empty }} {{ .env }}": "none map[GREETING:Hello]",
+	} {
+		tool := types.Tool{
+			Instructions: types.TemplatePrefix + "\n" + body,
+		}
+		ret, err := e.runTemplate(tool, `{"name": "Bob", "count": 3, "tags": ["a", "b"], "empty": ""}`)
+		require.NoError(t, err, body)
+		assert.Equal(t, expected, *ret.Result, body)
+	}
+}
+
+func TestRunTemplateErrorLine(t *testing.T) {
+	e := &Engine{
+		Progress: make(chan types.CompletionStatus, 10),
+	}
+
+	for text, line := range map[string]int{
+		"name: render\n\n#!sys.template\nfirst\n{{ .name | nope }}\n": 5,
+		"name: render\n\n#!sys.template\n{{ index .name 3 }}\n":       4,
+	} {
+		tools, err := parser.ParseTools(strings.NewReader(text), parser.Options{Location: "render.gpt"})
+		require.NoError(t, err)
+
+		_, err = e.runTemplate(tools[0], `{"name": "Bob"}`)
+		errLine := (*parser.ErrLine)(nil)
+		require.True(t, errors.As(err, &errLine), text)
+		assert.Equal(t, "render.gpt", errLine.Path)
+		assert.Equal(t, line, errLine.Line, text)
+	}
+}
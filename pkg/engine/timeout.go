@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// ErrTimeout is returned when a command or LLM call of a tool does not finish within the timeout of the tool.
+type ErrTimeout struct {
+	ToolName string
+	Timeout  time.Duration
+	Err      error
+}
+
+func (e *ErrTimeout) Error() string {
+	return fmt.Sprintf("tool [%s] timed out after %s", e.ToolName, e.Timeout)
+}
+
+func (e *ErrTimeout) Unwrap() error {
+	return e.Err
+}
+
+func (e *Engine) timeout(tool types.Tool) time.Duration {
+	return types.FirstSet(time.Duration(tool.Timeout), e.Timeout)
+}
+
+// withTimeout returns a copy of ctx that is canceled once the timeout of its tool has passed.
+func (e *Engine) withTimeout(ctx Context) (Context, context.CancelFunc) {
+	timeout := e.timeout(ctx.Tool)
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	var cancel context.CancelFunc
+	ctx.Ctx, cancel = context.WithTimeout(ctx.Ctx, timeout)
+	return ctx, cancel
+}
+
+// timeoutError returns an ErrTimeout if err was caused by the timeout of timeoutCtx and not by ctx being canceled.
+func (e *Engine) timeoutError(ctx, timeoutCtx Context, err error) error {
+	if err == nil || !errors.Is(timeoutCtx.Ctx.Err(), context.DeadlineExceeded) || ctx.Ctx.Err() != nil {
+		return err
+	}
+	return &ErrTimeout{
+		ToolName: ctx.Tool.Name,
+		Timeout:  e.timeout(ctx.Tool),
+		Err:      err,
+	}
+}
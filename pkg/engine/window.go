@@ -0,0 +1,255 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	DropOldestToolResults = "drop-oldest-tool-results"
+	SummarizeWithModel    = "summarize-with-model"
+
+	// imageTokens is a rough estimate of the tokens used by an image, which depends on its size and the model
+	imageTokens = 1000
+
+	// defaultOutputReserve is the number of tokens left free for the response when the context limit
+	// comes from the size of the model and the tool does not set Max Tokens.
+	defaultOutputReserve = 4096
+
+	removedToolResult = "[This tool result was removed to fit the context window]"
+	summaryPrompt     = `Summarize the following conversation between a user, an assistant and the tools the assistant called.
+Keep every fact, decision, file name, identifier and open question that is needed to continue the task.
+Respond only with the summary.`
+)
+
+// ContextStrategy shrinks the messages of a completion request so that they fit within limit tokens.
+// The system message at the start of the messages must be kept.
+type ContextStrategy interface {
+	Fit(ctx context.Context, model Model, progress chan<- types.CompletionStatus, completion types.CompletionRequest, limit int) ([]types.CompletionMessage, error)
+}
+
+var ContextStrategies = map[string]ContextStrategy{
+	DropOldestToolResults: dropOldestToolResults{},
+	SummarizeWithModel:    summarizeWithModel{},
+}
+
+// ModelContextSizes is the size of the context window of known models. Models are matched by their exact name
+// or a dated snapshot of it, so "gpt-4o" also matches "gpt-4o-2024-08-06" but not "gpt-4o1". The longest matching
+// name wins, and models that are not listed have no known size.
+var ModelContextSizes = map[string]int{
+	"gpt-4o":        128_000,
+	"gpt-4-turbo":   128_000,
+	"gpt-4-1106":    128_000,
+	"gpt-4-0125":    128_000,
+	"gpt-4-32k":     32_768,
+	"gpt-4":         8_192,
+	"gpt-3.5-turbo": 16_385,
+	"o1":            200_000,
+	"o1-mini":       128_000,
+	"o1-preview":    128_000,
+	"claude-3":      200_000,
+	"claude-2":      100_000,
+}
+
+func modelContextSize(model string) int {
+	model, _, _ = strings.Cut(model, " from ")
+	model = strings.TrimSpace(model)
+
+	var (
+		match string
+		size  int
+	)
+	for name, v := range ModelContextSizes {
+		if (model == name || strings.HasPrefix(model, name+"-")) && len(name) > len(match) {
+			match, size = name, v
+		}
+	}
+	return size
+}
+
+// contextLimit returns the number of tokens the messages of a completion may use, or zero if there is no known limit.
+func contextLimit(tool types.Tool, completion types.CompletionRequest) int {
+	if tool.MaxContext > 0 {
+		return tool.MaxContext
+	}
+
+	size := modelContextSize(completion.Model)
+	if size == 0 {
+		return 0
+	}
+
+	reserve := completion.MaxTokens
+	if reserve <= 0 {
+		reserve = defaultOutputReserve
+	}
+	return size - min(reserve, size/2)
+}
+
+// estimateTokens approximates the tokens used by messages and tools at four characters per token. It is not
+// exact, but it avoids depending on the tokenizer of every provider.
+func estimateTokens(tools []types.CompletionTool, messages []types.CompletionMessage) (result int) {
+	if len(tools) > 0 {
+		data, _ := json.Marshal(tools)
+		result += len(data) / 4
+	}
+	for _, msg := range messages {
+		result += messageTokens(msg)
+	}
+	return
+}
+
+func messageTokens(msg types.CompletionMessage) int {
+	// A few tokens of overhead for the role and message framing
+	chars := 16
+	for _, content := range msg.Content {
+		chars += len(content.Text)
+		if content.ToolCall != nil {
+			chars += len(content.ToolCall.ID) + len(content.ToolCall.Function.Name) + len(content.ToolCall.Function.Arguments)
+		}
+		if content.Image != nil {
+			chars += imageTokens * 4
+		}
+	}
+	return chars / 4
+}
+
+// fitContext runs the context strategy if the messages of the state no longer fit in the context window.
+// The messages before the first change are kept in State.OriginalMessages.
+func (e *Engine) fitContext(ctx Context, state *State) error {
+	limit := contextLimit(ctx.Tool, state.Completion)
+	if limit <= 0 {
+		return nil
+	}
+
+	tokens := estimateTokens(state.Completion.Tools, state.Completion.Messages)
+	if tokens <= limit {
+		return nil
+	}
+
+	strategy := e.ContextStrategy
+	if strategy == nil {
+		strategy = dropOldestToolResults{}
+	}
+
+	progress, closeProgress := e.forwardProgress()
+	messages, err := strategy.Fit(ctx.Ctx, e.Model, progress, state.Completion, limit)
+	closeProgress()
+	if err != nil {
+		return fmt.Errorf("failed to fit messages to context window of %d tokens: %w", limit, err)
+	}
+
+	log.Debugf("reduced messages for tool [%s] from an estimated %d to %d tokens, limit %d", ctx.Tool.Name, tokens,
+		estimateTokens(state.Completion.Tools, messages), limit)
+
+	if state.OriginalMessages == nil {
+		state.OriginalMessages = slices.Clone(state.Completion.Messages)
+	}
+	state.Completion.Messages = messages
+	return nil
+}
+
+type dropOldestToolResults struct{}
+
+// Fit replaces the content of tool results, oldest first, until the messages fit. The tool messages themselves
+// are kept so that every tool call still has a result.
+func (dropOldestToolResults) Fit(_ context.Context, _ Model, _ chan<- types.CompletionStatus, completion types.CompletionRequest, limit int) ([]types.CompletionMessage, error) {
+	var (
+		messages = slices.Clone(completion.Messages)
+		tokens   = estimateTokens(completion.Tools, messages)
+	)
+
+	for i, msg := range messages {
+		if tokens <= limit {
+			break
+		}
+		if msg.Role != types.CompletionMessageRoleTypeTool || msg.String() == removedToolResult {
+			continue
+		}
+		messages[i].Content = types.Text(removedToolResult)
+		tokens += messageTokens(messages[i]) - messageTokens(msg)
+	}
+
+	return messages, nil
+}
+
+type summarizeWithModel struct{}
+
+// Fit asks the model to summarize the older messages and replaces them with the summary. The most recent
+// messages are kept as is, using up to half of the limit.
+func (summarizeWithModel) Fit(ctx context.Context, model Model, progress chan<- types.CompletionStatus, completion types.CompletionRequest, limit int) ([]types.CompletionMessage, error) {
+	var (
+		messages = completion.Messages
+		start    int
+	)
+
+	if len(messages) > 0 && messages[0].Role == types.CompletionMessageRoleTypeSystem {
+		start = 1
+	}
+
+	// Find the oldest message that can be kept while staying under half the limit. The kept messages
+	// can not start with a tool result, as it would be separated from its tool call.
+	split := len(messages)
+	available := limit/2 - estimateTokens(completion.Tools, messages[:start])
+	for i := len(messages) - 1; i > start; i-- {
+		available -= messageTokens(messages[i])
+		if available < 0 {
+			break
+		}
+		if messages[i].Role != types.CompletionMessageRoleTypeTool {
+			split = i
+		}
+	}
+
+	if split-start < 2 {
+		// Not enough history to be worth a summary
+		return dropOldestToolResults{}.Fit(ctx, model, progress, completion, limit)
+	}
+
+	resp, err := model.Call(ctx, types.CompletionRequest{
+		Model:                completion.Model,
+		ModelFallbacks:       completion.ModelFallbacks,
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{
+				Role:    types.CompletionMessageRoleTypeSystem,
+				Content: types.Text(summaryPrompt),
+			},
+			{
+				Role:    types.CompletionMessageRoleTypeUser,
+				Content: types.Text(transcript(messages[start:split])),
+			},
+		},
+	}, progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize messages: %w", err)
+	}
+
+	result := slices.Clone(messages[:start])
+	result = append(result, types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeUser,
+		Content: types.Text("Summary of the conversation so far:\n\n" + resp.String()),
+	})
+	result = append(result, messages[split:]...)
+
+	completion.Messages = result
+	return dropOldestToolResults{}.Fit(ctx, model, progress, completion, limit)
+}
+
+func transcript(messages []types.CompletionMessage) string {
+	buf := &strings.Builder{}
+	for _, msg := range messages {
+		for _, content := range msg.Content {
+			if content.ToolCall != nil {
+				_, _ = fmt.Fprintf(buf, "%s: called tool %s with %s\n", msg.Role, content.ToolCall.Function.Name, content.ToolCall.Function.Arguments)
+			} else if content.Text != "" {
+				_, _ = fmt.Fprintf(buf, "%s: %s\n", msg.Role, content.Text)
+			}
+		}
+	}
+	return buf.String()
+}
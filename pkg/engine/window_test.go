@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingModel struct {
+	requests []types.CompletionRequest
+	response string
+}
+
+func (r *recordingModel) Call(_ context.Context, messageRequest types.CompletionRequest, _ chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	r.requests = append(r.requests, messageRequest)
+	return &types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeAssistant,
+		Content: types.Text(r.response),
+	}, nil
+}
+
+func toolCallState(results int) (*State, []CallResult) {
+	state := &State{
+		Completion: types.CompletionRequest{
+			Model: "test-model",
+			Messages: []types.CompletionMessage{
+				{Role: types.CompletionMessageRoleTypeSystem, Content: types.Text("Be helpful")},
+				{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Read the files")},
+			},
+		},
+		Pending: map[string]types.CompletionToolCall{},
+	}
+
+	var (
+		calls       []types.ContentPart
+		callResults []CallResult
+	)
+	for i := 0; i < results; i++ {
+		id := string(rune('a' + i))
+		index := 0
+		call := types.CompletionToolCall{
+			Index:    &index,
+			ID:       id,
+			Function: types.CompletionFunctionCall{Name: "read", Arguments: "{}"},
+		}
+		calls = append(calls, types.ContentPart{ToolCall: &call})
+		state.Pending[id] = call
+		callResults = append(callResults, CallResult{
+			CallID: id,
+			Result: strings.Repeat("x", 400),
+		})
+	}
+
+	state.Completion.Tools = []types.CompletionTool{{Function: types.CompletionFunctionDefinition{ToolID: "read", Name: "read"}}}
+	state.Completion.Messages = append(state.Completion.Messages, types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeAssistant,
+		Content: calls,
+	})
+
+	return state, callResults
+}
+
+func TestContinueDropsOldestToolResults(t *testing.T) {
+	model := &recordingModel{response: "done"}
+	e := &Engine{Model: model}
+
+	ctx := Context{Ctx: context.Background()}
+	ctx.Tool.MaxContext = 250
+
+	state, results := toolCallState(3)
+	ret, err := e.Continue(ctx, state, results...)
+	require.NoError(t, err)
+
+	require.Len(t, model.requests, 1)
+	messages := model.requests[0].Messages
+	require.Len(t, messages, 6)
+	assert.Equal(t, removedToolResult, messages[3].String())
+	assert.Equal(t, removedToolResult, messages[4].String())
+	assert.Equal(t, strings.Repeat("x", 400), messages[5].String())
+	assert.LessOrEqual(t, estimateTokens(model.requests[0].Tools, messages), 250)
+
+	// The full history is kept for debugging, including the response
+	require.Len(t, ret.State.OriginalMessages, 7)
+	assert.Equal(t, strings.Repeat("x", 400), ret.State.OriginalMessages[3].String())
+	assert.Equal(t, "done", ret.State.OriginalMessages[6].String())
+	assert.Len(t, ret.State.Completion.Messages, 7)
+}
+
+func TestContinueUnderLimit(t *testing.T) {
+	model := &recordingModel{response: "done"}
+	e := &Engine{Model: model}
+
+	ctx := Context{Ctx: context.Background()}
+	ctx.Tool.MaxContext = 10_000
+
+	state, results := toolCallState(3)
+	ret, err := e.Continue(ctx, state, results...)
+	require.NoError(t, err)
+
+	assert.Nil(t, ret.State.OriginalMessages)
+	assert.Equal(t, strings.Repeat("x", 400), model.requests[0].Messages[3].String())
+}
+
+func TestSummarizeWithModel(t *testing.T) {
+	model := &recordingModel{response: "The user asked to read files"}
+
+	state, _ := toolCallState(1)
+	completion := state.Completion
+	for i := 0; i < 10; i++ {
+		completion.Messages = append(completion.Messages,
+			types.CompletionMessage{Role: types.CompletionMessageRoleTypeUser, Content: types.Text(strings.Repeat("question ", 20))},
+			types.CompletionMessage{Role: types.CompletionMessageRoleTypeAssistant, Content: types.Text(strings.Repeat("answer ", 20))},
+		)
+	}
+
+	messages, err := summarizeWithModel{}.Fit(context.Background(), model, nil, completion, 300)
+	require.NoError(t, err)
+
+	require.Len(t, model.requests, 1)
+	assert.Equal(t, "test-model", model.requests[0].Model)
+	assert.Contains(t, model.requests[0].Messages[1].String(), "assistant: called tool read with {}")
+
+	assert.Equal(t, types.CompletionMessageRoleTypeSystem, messages[0].Role)
+	assert.Equal(t, "Summary of the conversation so far:\n\nThe user asked to read files", messages[1].String())
+	assert.Equal(t, completion.Messages[len(completion.Messages)-1], messages[len(messages)-1])
+	assert.LessOrEqual(t, estimateTokens(completion.Tools, messages), 300)
+}
+
+func TestContextLimit(t *testing.T) {
+	assert.Equal(t, 0, contextLimit(types.Tool{}, types.CompletionRequest{Model: "unknown"}))
+	assert.Equal(t, 128_000-4096, contextLimit(types.Tool{}, types.CompletionRequest{Model: "gpt-4o-2024-08-06"}))
+	assert.Equal(t, 8_192-1000, contextLimit(types.Tool{}, types.CompletionRequest{Model: "gpt-4", MaxTokens: 1000}))
+	assert.Equal(t, 200_000-4096, contextLimit(types.Tool{}, types.CompletionRequest{Model: "claude-3-5-sonnet-latest from github.com/example/provider"}))
+
+	tool := types.Tool{}
+	tool.MaxContext = 500
+	assert.Equal(t, 500, contextLimit(tool, types.CompletionRequest{Model: "gpt-4o"}))
+}
+
+func TestModelContextSize(t *testing.T) {
+	assert.Equal(t, 8_192, modelContextSize("gpt-4"))
+	assert.Equal(t, 8_192, modelContextSize("gpt-4-0613"))
+	assert.Equal(t, 128_000, modelContextSize("gpt-4-turbo-2024-04-09"))
+	assert.Equal(t, 128_000, modelContextSize("o1-mini-2024-09-12"))
+
+	// Models that only share a prefix with a known model have no known size
+	assert.Equal(t, 0, modelContextSize("gpt-4.1"))
+	assert.Equal(t, 0, modelContextSize("gpt-4.5-preview"))
+	assert.Equal(t, 0, modelContextSize("o1x"))
+}
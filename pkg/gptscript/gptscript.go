@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
 	"github.com/gptscript-ai/gptscript/pkg/builtin"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/config"
 	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/hash"
 	"github.com/gptscript-ai/gptscript/pkg/llm"
@@ -31,12 +33,15 @@ type GPTScript struct {
 type Options struct {
 	Cache             cache.Options
 	OpenAI            openai.Options
+	Anthropic         anthropic.Options
 	Monitor           monitor.Options
 	Runner            runner.Options
 	CredentialContext string
 	Quiet             *bool
 	Workspace         string
 	Env               []string
+	Record            string
+	Replay            string
 }
 
 func complete(opts *Options) (result *Options) {
@@ -56,7 +61,13 @@ func complete(opts *Options) (result *Options) {
 func New(opts *Options) (*GPTScript, error) {
 	opts = complete(opts)
 
+	cliCfg, err := config.ReadCLIConfig(opts.OpenAI.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
 	registry := llm.NewRegistry()
+	registry.SetDefaultFallbacks(cliCfg.ModelFallbacks)
 
 	cacheClient, err := cache.New(opts.Cache)
 	if err != nil {
@@ -75,6 +86,24 @@ func New(opts *Options) (*GPTScript, error) {
 		return nil, err
 	}
 
+	anthropicClient, err := anthropic.NewClient(opts.Anthropic, anthropic.Options{
+		Cache: cacheClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := registry.AddClient(anthropicClient); err != nil {
+		return nil, err
+	}
+
+	if err := setModelProviders(registry, cliCfg.ModelProviders, map[string]llm.Client{
+		"openai":    oAIClient,
+		"anthropic": anthropicClient,
+	}); err != nil {
+		return nil, err
+	}
+
 	if opts.Runner.MonitorFactory == nil {
 		opts.Runner.MonitorFactory = monitor.NewConsole(append([]monitor.Options{opts.Monitor}, monitor.Options{
 			DisplayProgress: !*opts.Quiet,
@@ -85,11 +114,27 @@ func New(opts *Options) (*GPTScript, error) {
 		opts.Runner.RuntimeManager = runtimes.Default(cacheClient.CacheDir())
 	}
 
-	runner, err := runner.New(registry, opts.CredentialContext, opts.Runner)
+	var model engine.Model = registry
+	if opts.Replay != "" && opts.Record != "" {
+		return nil, fmt.Errorf("record and replay can not be used together")
+	} else if opts.Replay != "" {
+		model, err = llm.NewReplayer(opts.Replay)
+	} else if opts.Record != "" {
+		model, err = llm.NewRecorder(registry, opts.Record)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	runner, err := runner.New(model, opts.CredentialContext, opts.Runner)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addModelAliases(registry, cliCfg.Models, cacheClient, runner, opts.Env); err != nil {
+		return nil, err
+	}
+
 	remoteClient := remote.New(runner, opts.Env, cacheClient)
 
 	if err := registry.AddClient(remoteClient); err != nil {
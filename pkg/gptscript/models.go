@@ -0,0 +1,125 @@
+package gptscript
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	openai2 "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/config"
+	"github.com/gptscript-ai/gptscript/pkg/llm"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/openai"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+func addModelAliases(registry *llm.Registry, models map[string]config.ModelConfig, cache *cache.Client, runner *runner.Runner, env []string) error {
+	for name, model := range models {
+		if model.Credential != "" && model.APIKeyEnv == "" {
+			// The credential sets environment variables, so the alias must name the one that has the API key
+			return fmt.Errorf("invalid model %s: credential requires apiKeyEnv", name)
+		}
+		alias := llm.Alias{
+			Model:       model.Model,
+			MaxTokens:   model.MaxTokens,
+			Temperature: model.Temperature,
+		}
+		if model.BaseURL != "" || model.APIType != "" || model.Deployment != "" || model.APIKeyEnv != "" || model.Credential != "" || model.Grammar {
+			alias.Client = &aliasClient{
+				name:   name,
+				config: model,
+				cache:  cache,
+				runner: runner,
+				env:    env,
+			}
+		}
+		registry.SetAlias(name, alias)
+	}
+	return nil
+}
+
+func setModelProviders(registry *llm.Registry, modelProviders map[string]string, clients map[string]llm.Client) error {
+	for model, provider := range modelProviders {
+		client, ok := clients[provider]
+		if !ok {
+			return fmt.Errorf("invalid provider %q for model %s, expected openai or anthropic", provider, model)
+		}
+		registry.SetModelProvider(model, client)
+	}
+	return nil
+}
+
+// aliasClient is the client of a model alias with its own provider. The client is created on first use, as
+// the API key may come from a credential tool that prompts the user.
+type aliasClient struct {
+	lock   sync.Mutex
+	client *openai.Client
+	name   string
+	config config.ModelConfig
+	cache  *cache.Client
+	runner *runner.Runner
+	env    []string
+}
+
+func (a *aliasClient) Call(ctx context.Context, messageRequest types.CompletionRequest, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	client, err := a.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.Call(ctx, messageRequest, status)
+}
+
+func (a *aliasClient) ListModels(context.Context, ...string) ([]string, error) {
+	return []string{a.config.Model}, nil
+}
+
+func (a *aliasClient) Supports(_ context.Context, modelName string) (bool, error) {
+	return modelName == a.config.Model, nil
+}
+
+func (a *aliasClient) load(ctx context.Context) (*openai.Client, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	var apiKey string
+	if a.config.APIKeyEnv != "" {
+		apiKey = os.Getenv(a.config.APIKeyEnv)
+	}
+
+	if a.config.Credential != "" {
+		prg, err := loader.Program(ctx, a.config.Credential, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load credential of model %s: %w", a.name, err)
+		}
+		credEnv, err := a.runner.CredentialEnv(ctx, prg, a.env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get credential of model %s: %w", a.name, err)
+		}
+		apiKey = types.FirstSet(credEnv[a.config.APIKeyEnv], apiKey)
+	}
+
+	client, err := openai.NewClient(openai.Options{
+		BaseURL:      a.config.BaseURL,
+		APIKey:       apiKey,
+		APIType:      openai2.APIType(a.config.APIType),
+		APIVersion:   a.config.APIVersion,
+		DefaultModel: a.config.Model,
+		Deployment:   a.config.Deployment,
+		Grammar:      a.config.Grammar,
+		Cache:        a.cache,
+		SetSeed:      true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for model %s: %w", a.name, err)
+	}
+
+	a.client = client
+	return client, nil
+}
@@ -0,0 +1,130 @@
+package gptscript
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/config"
+	"github.com/gptscript-ai/gptscript/pkg/llm"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// provider is an OpenAI compatible server that records the requests it gets.
+type provider struct {
+	*httptest.Server
+	body map[string]any
+	auth string
+}
+
+func newProvider(t *testing.T) *provider {
+	p := &provider{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.body = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&p.body))
+		p.auth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"hello\"}}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func callAlias(t *testing.T, registry *llm.Registry, request types.CompletionRequest) (*types.CompletionMessage, error) {
+	t.Helper()
+
+	status := make(chan types.CompletionStatus)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range status {
+		}
+	}()
+	defer func() {
+		close(status)
+		<-done
+	}()
+
+	request.Messages = []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hi")}}
+	return registry.Call(context.Background(), request, status)
+}
+
+func TestAliasClient(t *testing.T) {
+	p := newProvider(t)
+	t.Setenv("ALIAS_API_KEY", "from env")
+
+	registry := llm.NewRegistry()
+	err := addModelAliases(registry, map[string]config.ModelConfig{
+		"local": {
+			Model:     "llama3.1",
+			BaseURL:   p.URL,
+			APIKeyEnv: "ALIAS_API_KEY",
+			MaxTokens: 100,
+		},
+	}, nil, nil, nil)
+	require.NoError(t, err)
+
+	resp, err := callAlias(t, registry, types.CompletionRequest{
+		Model: "local",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.String())
+
+	// The request goes to the provider of the alias, for the model of the alias
+	assert.Equal(t, "llama3.1", p.body["model"])
+	assert.Equal(t, float64(100), p.body["max_tokens"])
+	assert.Equal(t, "Bearer from env", p.auth)
+
+	models, err := registry.ListModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"local"}, models)
+}
+
+func TestAliasClientCredential(t *testing.T) {
+	t.Setenv("GPTSCRIPT_CONFIG_FILE", filepath.Join(t.TempDir(), "config.json"))
+	t.Setenv("ALIAS_API_KEY", "from env")
+	p := newProvider(t)
+
+	registry := llm.NewRegistry()
+	r, err := runner.New(registry, "default")
+	require.NoError(t, err)
+
+	err = addModelAliases(registry, map[string]config.ModelConfig{
+		"private": {
+			Model:      "private-model",
+			BaseURL:    p.URL,
+			APIKeyEnv:  "ALIAS_API_KEY",
+			Credential: filepath.Join("testdata", "credential.gpt"),
+		},
+	}, nil, r, nil)
+	require.NoError(t, err)
+
+	_, err = callAlias(t, registry, types.CompletionRequest{
+		Model: "private",
+	})
+	require.NoError(t, err)
+
+	// The key set by the credential is used instead of the environment
+	assert.Equal(t, "private-model", p.body["model"])
+	assert.Equal(t, "Bearer from credential", p.auth)
+}
+
+func TestAliasClientCredentialWithoutKeyEnv(t *testing.T) {
+	registry := llm.NewRegistry()
+	err := addModelAliases(registry, map[string]config.ModelConfig{
+		"private": {
+			Model:      "private-model",
+			BaseURL:    "http://localhost",
+			Credential: filepath.Join("testdata", "credential.gpt"),
+		},
+	}, nil, nil, nil)
+	require.ErrorContains(t, err, "invalid model private: credential requires apiKeyEnv")
+}
@@ -5,6 +5,8 @@ import (
 	"io"
 	"os"
 	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
 )
 
 func FromArgs(args []string) string {
@@ -39,3 +41,24 @@ func FromFile(file string) (string, error) {
 
 	return "", nil
 }
+
+// WithImages adds images, given as local files or data URLs, to the input. The result is an image envelope
+// that is sent to the model as text and image content.
+func WithImages(input string, images []string) (string, error) {
+	if len(images) == 0 {
+		return input, nil
+	}
+
+	var parts []types.ContentPart
+	if input != "" {
+		parts = append(parts, types.ContentPart{Text: input})
+	}
+	for _, image := range images {
+		part, err := types.ReadImage(image)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	return types.ContentString(parts), nil
+}
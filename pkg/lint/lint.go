@@ -0,0 +1,339 @@
+package lint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/parser"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Problem is something wrong with a tool that lint found.
+type Problem struct {
+	Severity string `json:"severity"`
+	Location string `json:"location,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Tool     string `json:"tool,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Errors returns the number of problems that are errors.
+func Errors(problems []Problem) (result int) {
+	for _, p := range problems {
+		if p.Severity == SeverityError {
+			result++
+		}
+	}
+	return
+}
+
+// File loads the program of a local file and reports the problems it would have at runtime, without running
+// any tool or calling any model.
+func File(ctx context.Context, file string) ([]Problem, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parser.ParseFormat(strings.NewReader(string(data)), parser.FormatOf(file), parser.Options{
+		AssignGlobals: true,
+		Location:      file,
+	})
+	if err != nil {
+		return []Problem{errorProblem(file, err)}, nil
+	}
+
+	l := &linter{
+		file:  file,
+		tools: doc.Tools(),
+	}
+
+	// The references are checked one by one first, as loading the program stops at the first that fails
+	l.checkReferences(ctx)
+	if Errors(l.problems) > 0 {
+		return l.result(), nil
+	}
+
+	prg, err := loader.Program(ctx, file, "")
+	if err != nil {
+		l.problems = append(l.problems, errorProblem(file, err))
+		return l.result(), nil
+	}
+
+	l.checkUnused()
+	for _, tool := range prg.ToolSet {
+		if tool.Source.Location == "" || tool.Source.Repo != nil || isRemote(tool.Source.Location) {
+			// Only the local tools can be fixed by the author of the program
+			continue
+		}
+		l.checkContext(prg, tool)
+		l.checkCredentials(prg, tool)
+		l.checkToolNames(prg, tool)
+		l.checkInterpreter(tool)
+	}
+
+	return l.result(), nil
+}
+
+type linter struct {
+	file     string
+	tools    []types.Tool
+	problems []Problem
+}
+
+func (l *linter) add(tool types.Tool, severity, format string, args ...any) {
+	l.problems = append(l.problems, Problem{
+		Severity: severity,
+		Location: types.FirstSet(tool.Source.Location, l.file),
+		Line:     tool.Source.LineNo,
+		Tool:     tool.Name,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) result() []Problem {
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		if l.problems[i].Location != l.problems[j].Location {
+			return l.problems[i].Location < l.problems[j].Location
+		}
+		return l.problems[i].Line < l.problems[j].Line
+	})
+	return l.problems
+}
+
+func errorProblem(file string, err error) Problem {
+	p := Problem{
+		Severity: SeverityError,
+		Location: file,
+		Message:  err.Error(),
+	}
+	if errLine := (*parser.ErrLine)(nil); errors.As(err, &errLine) {
+		p.Location = types.FirstSet(errLine.Path, file)
+		p.Line = errLine.Line
+		p.Message = errLine.Err.Error()
+	}
+	return p
+}
+
+func isRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+func references(tool types.Tool) []string {
+	return slices.Concat(tool.Tools, tool.Export, tool.ExportContext, tool.Context, tool.Credentials)
+}
+
+// localTool returns the tool of the file a reference points to.
+func (l *linter) localTool(ref string) (types.Tool, bool) {
+	name, _ := types.SplitArg(ref)
+	for _, tool := range l.tools {
+		if tool.Name != "" && strings.EqualFold(tool.Name, name) {
+			return tool, true
+		}
+	}
+	return types.Tool{}, false
+}
+
+func (l *linter) checkReferences(ctx context.Context) {
+	dir := filepath.Dir(l.file)
+	for _, tool := range l.tools {
+		for _, ref := range references(tool) {
+			if _, ok := l.localTool(ref); ok {
+				continue
+			}
+			if _, err := loader.ProgramFromReference(ctx, dir, ref); err != nil {
+				message := fmt.Sprintf("unresolved tool reference %q: %v", ref, err)
+				if suggestion := l.closestTool(ref); suggestion != "" {
+					message += fmt.Sprintf(", did you mean %q?", suggestion)
+				}
+				l.add(tool, SeverityError, "%s", message)
+			}
+		}
+	}
+}
+
+// closestTool returns the name of the tool of the file a misspelled reference most likely meant.
+func (l *linter) closestTool(ref string) (result string) {
+	name, _ := types.SplitArg(ref)
+	best := max(2, len(name)/4) + 1
+	for _, tool := range l.tools {
+		if tool.Name == "" {
+			continue
+		}
+		if d := distance(strings.ToLower(name), strings.ToLower(tool.Name)); d < best {
+			best, result = d, tool.Name
+		}
+	}
+	return
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// checkUnused reports the named tools of the file that no other tool of the file references.
+func (l *linter) checkUnused() {
+	used := map[string]bool{}
+	for _, tool := range l.tools {
+		for _, ref := range references(tool) {
+			if target, ok := l.localTool(ref); ok && !strings.EqualFold(target.Name, tool.Name) {
+				used[strings.ToLower(target.Name)] = true
+			}
+		}
+	}
+
+	for i, tool := range l.tools {
+		// The first tool is the entrypoint of the file
+		if i == 0 || tool.Name == "" || used[strings.ToLower(tool.Name)] {
+			continue
+		}
+		l.add(tool, SeverityWarning, "tool %q is never used", tool.Name)
+	}
+}
+
+// checkContext reports the "with ... as" mappings of context tools that fail at runtime.
+func (l *linter) checkContext(prg types.Program, tool types.Tool) {
+	refs, err := prg.GetContextToolRefs(tool.ID)
+	if err != nil {
+		l.add(tool, SeverityError, "invalid context: %v", err)
+		return
+	}
+	for _, ref := range refs {
+		if err := runner.ValidateContextInput(&prg, ref); err != nil {
+			l.add(tool, SeverityError, "invalid arguments of context %q: %v", ref.Reference, err)
+		}
+	}
+}
+
+// checkCredentials reports the credential tools without a name.
+func (l *linter) checkCredentials(prg types.Program, tool types.Tool) {
+	for _, ref := range tool.Credentials {
+		if credTool, ok := prg.ToolSet[tool.ToolMapping[ref]]; ok && credTool.Name == "" {
+			l.add(tool, SeverityWarning, "credential tool %q has no name", ref)
+		}
+	}
+}
+
+// checkToolNames reports the tools the LLM would see under the same name, which types.PickToolName renames by
+// appending zeros.
+func (l *linter) checkToolNames(prg types.Program, tool types.Tool) {
+	var (
+		names = map[string][]string{}
+		seen  = map[string]bool{}
+		visit func(parent types.Tool, ref string)
+	)
+	visit = func(parent types.Tool, ref string) {
+		subTool, ok := prg.ToolSet[parent.ToolMapping[ref]]
+		if !ok || seen[subTool.ID] {
+			return
+		}
+		seen[subTool.ID] = true
+		if subTool.Instructions != "" {
+			name := types.ToolNormalizer(types.FirstSet(ref, "external"))
+			names[name] = append(names[name], ref)
+		}
+		for _, export := range subTool.Export {
+			visit(subTool, export)
+		}
+	}
+
+	for _, ref := range tool.Tools {
+		visit(tool, ref)
+	}
+	for _, ref := range tool.Context {
+		if contextTool, ok := prg.ToolSet[tool.ToolMapping[ref]]; ok {
+			for _, export := range contextTool.Export {
+				visit(contextTool, export)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(names))
+	for name := range names {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		if refs := names[name]; len(refs) > 1 {
+			l.add(tool, SeverityWarning, "tools %s are all named %q for the LLM and will be renamed by appending zeros",
+				strings.Join(refs, ", "), name)
+		}
+	}
+}
+
+// checkInterpreter reports the command tools whose interpreter can not be found.
+func (l *linter) checkInterpreter(tool types.Tool) {
+	if !tool.IsCommand() || tool.IsDaemon() || tool.IsOpenAPI() || tool.IsPrint() || tool.IsHTTP() || tool.BuiltinFunc != nil {
+		return
+	}
+
+	line, _, _ := strings.Cut(tool.Instructions, "\n")
+	args, err := shlex.Split(strings.TrimSpace(line)[2:])
+	if err != nil || len(args) == 0 {
+		l.add(tool, SeverityError, "invalid command %q: %v", line, err)
+		return
+	}
+
+	if args[0] == "/usr/bin/env" || args[0] == "/bin/env" {
+		args = slices.DeleteFunc(args[1:], func(arg string) bool {
+			return strings.HasPrefix(arg, "-") || strings.Contains(arg, "=")
+		})
+		if len(args) == 0 {
+			return
+		}
+	}
+
+	var unknown bool
+	interpreter := os.Expand(args[0], func(key string) string {
+		if key == "GPTSCRIPT_TOOL_DIR" {
+			return tool.WorkingDir
+		}
+		value, ok := os.LookupEnv(key)
+		unknown = unknown || !ok
+		return value
+	})
+	if unknown || strings.HasPrefix(interpreter, "sys.") {
+		// The value of the variable is only known at runtime
+		return
+	}
+
+	if strings.ContainsRune(interpreter, '/') || strings.ContainsRune(interpreter, filepath.Separator) {
+		if _, err := os.Stat(interpreter); err != nil {
+			l.add(tool, SeverityError, "interpreter %s of command not found", interpreter)
+		}
+	} else if _, err := exec.LookPath(interpreter); err != nil {
+		l.add(tool, SeverityError, "interpreter %s of command is not on PATH", interpreter)
+	}
+}
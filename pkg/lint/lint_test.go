@@ -0,0 +1,121 @@
+package lint
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestMisspelledReference(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.gpt": "tools: helpr, sys.read\n\nHello\n---\nname: helper\n\nHelp\n",
+	})
+
+	problems, err := File(context.Background(), filepath.Join(dir, "main.gpt"))
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, SeverityError, problems[0].Severity)
+	assert.Equal(t, 1, problems[0].Line)
+	assert.Contains(t, problems[0].Message, `unresolved tool reference "helpr"`)
+	assert.Contains(t, problems[0].Message, `did you mean "helper"?`)
+}
+
+func TestParseError(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.gpt": "name: main\nmax tokens: many\n\nHello\n",
+	})
+
+	problems, err := File(context.Background(), filepath.Join(dir, "main.gpt"))
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, 2, problems[0].Line)
+	assert.Equal(t, 1, Errors(problems))
+}
+
+func TestProblems(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.gpt": `tools: foo, ./foo.gpt, missing
+context: ctx with ${name} as nope
+credentials: ./cred.gpt
+
+Hello
+---
+name: foo
+
+Foo
+---
+name: unused
+
+Not used
+---
+name: ctx
+args: first: the first
+args: second: the second
+
+#!/bin/echo context
+---
+name: missing
+
+#!definitely-not-a-real-interpreter-xyz
+`,
+		"foo.gpt":  "Another foo\n",
+		"cred.gpt": "\n#!/bin/echo {}\n",
+	})
+
+	problems, err := File(context.Background(), filepath.Join(dir, "main.gpt"))
+	require.NoError(t, err)
+
+	var messages []string
+	for _, p := range problems {
+		messages = append(messages, p.Severity+": "+p.Message)
+	}
+	assert.Equal(t, []string{
+		`error: invalid arguments of context "ctx with ${name} as nope": can not assign arg to context because target tool [` +
+			filepath.Join(dir, "main.gpt") + `:15] has does not args [nope]`,
+		`warning: credential tool "./cred.gpt" has no name`,
+		`warning: tools foo, ./foo.gpt are all named "foo" for the LLM and will be renamed by appending zeros`,
+		`warning: tool "unused" is never used`,
+		`error: interpreter definitely-not-a-real-interpreter-xyz of command is not on PATH`,
+	}, messages)
+	assert.Equal(t, 2, Errors(problems))
+}
+
+func TestInterpreterFromEnv(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.gpt": "name: main\n\n#!/usr/bin/env python3 ${GPTSCRIPT_TOOL_DIR}/main.py\n",
+	})
+
+	// Local tools do not get a runtime, so the interpreter has to be on PATH
+	t.Setenv("PATH", t.TempDir())
+	problems, err := File(context.Background(), filepath.Join(dir, "main.gpt"))
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, "interpreter python3 of command is not on PATH", problems[0].Message)
+
+	bin := writeFiles(t, map[string]string{
+		"python3": "#!/bin/sh\n",
+	})
+	require.NoError(t, os.Chmod(filepath.Join(bin, "python3"), 0755))
+	t.Setenv("PATH", bin)
+	problems, err = File(context.Background(), filepath.Join(dir, "main.gpt"))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestDistance(t *testing.T) {
+	assert.Equal(t, 0, distance("tool", "tool"))
+	assert.Equal(t, 1, distance("helpr", "helper"))
+	assert.Equal(t, 3, distance("kitten", "sitting"))
+}
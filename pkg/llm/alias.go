@@ -0,0 +1,40 @@
+package llm
+
+import (
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// Alias is a model name that resolves to another model, optionally served by its own client and with default
+// parameters for the requests that do not set them.
+type Alias struct {
+	Model string
+	// Client serves the model instead of the clients of the registry
+	Client      Client
+	MaxTokens   int
+	Temperature *float32
+}
+
+// SetAlias adds a model alias. Requests for the alias are sent to its model.
+func (r *Registry) SetAlias(name string, alias Alias) {
+	if r.aliases == nil {
+		r.aliases = map[string]Alias{}
+	}
+	r.aliases[name] = alias
+}
+
+// resolveAlias returns the request for the model the alias points to and the client of the alias, if any.
+func (r *Registry) resolveAlias(messageRequest types.CompletionRequest) (types.CompletionRequest, Client) {
+	alias, ok := r.aliases[messageRequest.Model]
+	if !ok {
+		return messageRequest, nil
+	}
+
+	messageRequest.Model = alias.Model
+	if messageRequest.MaxTokens == 0 {
+		messageRequest.MaxTokens = alias.MaxTokens
+	}
+	if messageRequest.Temperature == nil {
+		messageRequest.Temperature = alias.Temperature
+	}
+	return messageRequest, alias.Client
+}
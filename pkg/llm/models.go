@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultModelsTTL is how long a client keeps the list of its models.
+const DefaultModelsTTL = 10 * time.Minute
+
+// ModelList caches the models of a client so that finding the client of a model does not list the models
+// of the provider on every call.
+type ModelList struct {
+	lock    sync.Mutex
+	ttl     time.Duration
+	models  []string
+	expires time.Time
+}
+
+// NewModelList returns a cache that keeps the models for ttl, DefaultModelsTTL if zero. A negative ttl
+// disables the cache.
+func NewModelList(ttl time.Duration) *ModelList {
+	if ttl == 0 {
+		ttl = DefaultModelsTTL
+	}
+	return &ModelList{
+		ttl: ttl,
+	}
+}
+
+// Get returns the cached models, or calls list if they are not cached or expired.
+func (m *ModelList) Get(ctx context.Context, list func(context.Context) ([]string, error)) ([]string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.models != nil && time.Now().Before(m.expires) {
+		return slices.Clone(m.models), nil
+	}
+
+	models, err := list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.ttl > 0 {
+		m.models = append([]string{}, models...)
+		m.expires = time.Now().Add(m.ttl)
+	}
+	return models, nil
+}
+
+// Invalidate drops the cached models so that the next Get lists them again.
+func (m *ModelList) Invalidate() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.models = nil
+}
@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelList(t *testing.T) {
+	var (
+		lists  int
+		models = []string{"a", "b"}
+		err    error
+		list   = func(context.Context) ([]string, error) {
+			lists++
+			return models, err
+		}
+		ctx   = context.Background()
+		cache = NewModelList(0)
+	)
+
+	result, listErr := cache.Get(ctx, list)
+	require.NoError(t, listErr)
+	assert.Equal(t, []string{"a", "b"}, result)
+
+	models = []string{"c"}
+	result, listErr = cache.Get(ctx, list)
+	require.NoError(t, listErr)
+	assert.Equal(t, []string{"a", "b"}, result)
+	assert.Equal(t, 1, lists)
+
+	cache.Invalidate()
+	result, listErr = cache.Get(ctx, list)
+	require.NoError(t, listErr)
+	assert.Equal(t, []string{"c"}, result)
+	assert.Equal(t, 2, lists)
+
+	// Errors are not cached
+	cache.Invalidate()
+	err = errors.New("unavailable")
+	_, listErr = cache.Get(ctx, list)
+	require.ErrorContains(t, listErr, "unavailable")
+	err = nil
+	_, listErr = cache.Get(ctx, list)
+	require.NoError(t, listErr)
+	assert.Equal(t, 4, lists)
+}
+
+func TestModelListDisabled(t *testing.T) {
+	var (
+		lists int
+		cache = NewModelList(-1)
+	)
+	for i := 0; i < 2; i++ {
+		_, err := cache.Get(context.Background(), func(context.Context) ([]string, error) {
+			lists++
+			return []string{"a"}, nil
+		})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, lists)
+}
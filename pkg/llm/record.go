@@ -0,0 +1,173 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Fixture is a completion saved by a Recorder.
+type Fixture struct {
+	Request  types.CompletionRequest `json:"request"`
+	Response types.CompletionMessage `json:"response"`
+	Model    string                  `json:"model,omitempty"`
+	Usage    types.Usage             `json:"usage,omitempty"`
+}
+
+func fixtureFile(dir string, messageRequest types.CompletionRequest) string {
+	return filepath.Join(dir, hash.Digest(messageRequest)[:16]+".json")
+}
+
+// Recorder saves every completion of a model as a fixture in a directory, to be served by a Replayer.
+type Recorder struct {
+	model engine.Model
+	dir   string
+}
+
+func NewRecorder(model engine.Model, dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create record directory: %w", err)
+	}
+	return &Recorder{
+		model: model,
+		dir:   dir,
+	}, nil
+}
+
+func (r *Recorder) Call(ctx context.Context, messageRequest types.CompletionRequest, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	fixture := Fixture{
+		Request: messageRequest,
+	}
+
+	recordStatus := make(chan types.CompletionStatus)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for s := range recordStatus {
+			fixture.Model = types.FirstSet(s.Model, fixture.Model)
+			if !s.Usage.IsZero() {
+				fixture.Usage = s.Usage
+			}
+			if status != nil {
+				status <- s
+			}
+		}
+	}()
+
+	resp, err := r.model.Call(ctx, messageRequest, recordStatus)
+	close(recordStatus)
+	<-done
+	if err != nil {
+		return nil, err
+	}
+
+	fixture.Response = *resp
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(fixtureFile(r.dir, messageRequest), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to record completion: %w", err)
+	}
+	return resp, nil
+}
+
+// Replayer answers completions only from the fixtures saved by a Recorder.
+type Replayer struct {
+	dir string
+}
+
+func NewReplayer(dir string) (*Replayer, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to read replay directory: %w", err)
+	}
+	return &Replayer{
+		dir: dir,
+	}, nil
+}
+
+func (r *Replayer) Call(_ context.Context, messageRequest types.CompletionRequest, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	data, err := os.ReadFile(fixtureFile(r.dir, messageRequest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, r.missing(messageRequest)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", fixtureFile(r.dir, messageRequest), err)
+	}
+
+	if status != nil {
+		status <- types.CompletionStatus{
+			CompletionID: hash.Digest(messageRequest)[:16],
+			Model:        fixture.Model,
+			Request:      messageRequest,
+			Response:     fixture.Response,
+			Usage:        fixture.Usage,
+			Cached:       true,
+		}
+	}
+	return &fixture.Response, nil
+}
+
+// missing returns the error for a request that was not recorded, with the difference to the closest recorded
+// request.
+func (r *Replayer) missing(messageRequest types.CompletionRequest) error {
+	err := fmt.Errorf("no recorded completion in %s for the request to model %s", r.dir, messageRequest.Model)
+
+	files, _ := filepath.Glob(filepath.Join(r.dir, "*.json"))
+	var (
+		closest      string
+		closestLines []string
+		closestRatio float64
+		request      = jsonLines(messageRequest)
+	)
+	for _, file := range files {
+		data, readErr := os.ReadFile(file)
+		if readErr != nil {
+			continue
+		}
+		var fixture Fixture
+		if json.Unmarshal(data, &fixture) != nil {
+			continue
+		}
+		lines := jsonLines(fixture.Request)
+		if ratio := difflib.NewMatcher(lines, request).Ratio(); closest == "" || ratio > closestRatio {
+			closest, closestLines, closestRatio = file, lines, ratio
+		}
+	}
+
+	if closest == "" {
+		return err
+	}
+	diff, diffErr := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        closestLines,
+		B:        request,
+		FromFile: filepath.Base(closest),
+		ToFile:   "request",
+		Context:  3,
+	})
+	if diffErr != nil {
+		return err
+	}
+	return fmt.Errorf("%w, the closest recorded request differs:\n%s", err, diff)
+}
+
+func jsonLines(obj any) []string {
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return nil
+	}
+	return difflib.SplitLines(string(data))
+}
@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRegistry()
+	require.NoError(t, r.AddClient(&testClient{
+		models: map[string]error{
+			"recorded": nil,
+		},
+	}))
+
+	recorder, err := NewRecorder(r, dir)
+	require.NoError(t, err)
+
+	request := types.CompletionRequest{
+		Model: "recorded",
+		Messages: []types.CompletionMessage{
+			{
+				Role:    types.CompletionMessageRoleTypeUser,
+				Content: types.Text("Hello"),
+			},
+		},
+	}
+	resp, _, err := callModel(t, recorder, request)
+	require.NoError(t, err)
+	assert.Equal(t, "answered by recorded", resp.String())
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	replayer, err := NewReplayer(dir)
+	require.NoError(t, err)
+
+	resp, status, err := callModel(t, replayer, request)
+	require.NoError(t, err)
+	assert.Equal(t, "answered by recorded", resp.String())
+	require.Len(t, status, 1)
+	assert.Equal(t, "recorded", status[0].Model)
+	assert.True(t, status[0].Cached)
+
+	request.Messages[0].Content = types.Text("Goodbye")
+	_, _, err = callModel(t, replayer, request)
+	require.ErrorContains(t, err, "no recorded completion in "+dir+" for the request to model recorded")
+	require.ErrorContains(t, err, "+++ request\n")
+	require.ErrorContains(t, err, "\n-          \"text\": \"Hello\"\n+          \"text\": \"Goodbye\"\n")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"sort"
 
 	"github.com/gptscript-ai/gptscript/pkg/types"
@@ -15,8 +16,27 @@ type Client interface {
 	Supports(ctx context.Context, modelName string) (bool, error)
 }
 
+// ErrModelUnavailable is returned by clients, wrapping the error of the provider, when a model can not answer a
+// request that another model might: rate limits, overloaded servers and dropped connections that remained after
+// retrying, a model that is not found and a request that does not fit in the context of the model. The registry
+// only falls back to the next model after these errors.
+type ErrModelUnavailable struct {
+	Err error
+}
+
+func (e *ErrModelUnavailable) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ErrModelUnavailable) Unwrap() error {
+	return e.Err
+}
+
 type Registry struct {
-	clients []Client
+	clients          []Client
+	defaultFallbacks []string
+	aliases          map[string]Alias
+	modelProviders   map[string]Client
 }
 
 func NewRegistry() *Registry {
@@ -28,6 +48,29 @@ func (r *Registry) AddClient(client Client) error {
 	return nil
 }
 
+// SetDefaultFallbacks sets the models to fall back to for requests that do not list their own fallbacks.
+func (r *Registry) SetDefaultFallbacks(models []string) {
+	r.defaultFallbacks = models
+}
+
+// SetModelProvider sends the requests for a model to client without asking the clients which of them supports
+// the model.
+func (r *Registry) SetModelProvider(model string, client Client) {
+	if r.modelProviders == nil {
+		r.modelProviders = map[string]Client{}
+	}
+	r.modelProviders[model] = client
+}
+
+// InvalidateModels drops the models cached by the clients, so that new models of the providers are found.
+func (r *Registry) InvalidateModels() {
+	for _, client := range r.clients {
+		if c, ok := client.(interface{ InvalidateModels() }); ok {
+			c.InvalidateModels()
+		}
+	}
+}
+
 func (r *Registry) ListModels(ctx context.Context, providers ...string) (result []string, _ error) {
 	for _, v := range r.clients {
 		models, err := v.ListModels(ctx, providers...)
@@ -36,6 +79,11 @@ func (r *Registry) ListModels(ctx context.Context, providers ...string) (result
 		}
 		result = append(result, models...)
 	}
+	if len(providers) == 0 {
+		for name := range r.aliases {
+			result = append(result, name)
+		}
+	}
 	sort.Strings(result)
 	return result, nil
 }
@@ -44,6 +92,82 @@ func (r *Registry) Call(ctx context.Context, messageRequest types.CompletionRequ
 	if messageRequest.Model == "" {
 		return nil, fmt.Errorf("model is required")
 	}
+
+	fallbacks := messageRequest.ModelFallbacks
+	if len(fallbacks) == 0 {
+		fallbacks = r.defaultFallbacks
+	}
+
+	models := []string{messageRequest.Model}
+	for _, fallback := range fallbacks {
+		if !slices.Contains(models, fallback) {
+			models = append(models, fallback)
+		}
+	}
+
+	var errs []error
+	for i, model := range models {
+		messageRequest.Model = model
+		messageRequest.ModelFallbacks = nil
+
+		resp, err := r.callModel(ctx, messageRequest, status)
+		if err == nil {
+			return resp, nil
+		}
+
+		errs = append(errs, fmt.Errorf("model %s: %w", model, err))
+		var unavailable *ErrModelUnavailable
+		if ctx.Err() != nil || !errors.As(err, &unavailable) || i == len(models)-1 {
+			break
+		}
+		log.Infof("Model [%s] failed, falling back to [%s]: %v", model, models[i+1], err)
+	}
+
+	if len(errs) == 1 {
+		return nil, errors.Unwrap(errs[0])
+	}
+	return nil, errors.Join(errs...)
+}
+
+// withModel sets the model on all the status sent by a client so that it is known which model answered.
+func withModel(status chan<- types.CompletionStatus, model string) (chan<- types.CompletionStatus, func()) {
+	if status == nil {
+		return nil, func() {}
+	}
+
+	var (
+		result = make(chan types.CompletionStatus)
+		done   = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+		for s := range result {
+			s.Model = model
+			status <- s
+		}
+	}()
+
+	return result, func() {
+		close(result)
+		<-done
+	}
+}
+
+func (r *Registry) callModel(ctx context.Context, messageRequest types.CompletionRequest, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	messageRequest, aliasClient := r.resolveAlias(messageRequest)
+
+	status, closeStatus := withModel(status, messageRequest.Model)
+	defer closeStatus()
+
+	if aliasClient != nil {
+		return aliasClient.Call(ctx, messageRequest, status)
+	}
+
+	if client, ok := r.modelProviders[messageRequest.Model]; ok {
+		return client.Call(ctx, messageRequest, status)
+	}
+
 	var errs []error
 	for _, client := range r.clients {
 		ok, err := client.Supports(ctx, messageRequest.Model)
@@ -54,7 +178,9 @@ func (r *Registry) Call(ctx context.Context, messageRequest types.CompletionRequ
 		}
 	}
 	if len(errs) == 0 {
-		return nil, fmt.Errorf("failed to find a model provider for model [%s]", messageRequest.Model)
+		return nil, &ErrModelUnavailable{
+			Err: fmt.Errorf("failed to find a model provider for model [%s]", messageRequest.Model),
+		}
 	}
 	return nil, errors.Join(errs...)
 }
@@ -0,0 +1,229 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testClient struct {
+	models map[string]error
+	calls  []string
+}
+
+func (t *testClient) Call(_ context.Context, messageRequest types.CompletionRequest, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	t.calls = append(t.calls, messageRequest.Model)
+	if err := t.models[messageRequest.Model]; err != nil {
+		return nil, err
+	}
+	status <- types.CompletionStatus{
+		CompletionID: "1",
+		Response:     messageRequest.Model,
+	}
+	return &types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeAssistant,
+		Content: types.Text("answered by " + messageRequest.Model),
+	}, nil
+}
+
+func (t *testClient) ListModels(context.Context, ...string) ([]string, error) {
+	return nil, nil
+}
+
+func (t *testClient) Supports(_ context.Context, modelName string) (bool, error) {
+	_, ok := t.models[modelName]
+	return ok, nil
+}
+
+func call(t *testing.T, r *Registry, request types.CompletionRequest) (*types.CompletionMessage, []types.CompletionStatus, error) {
+	t.Helper()
+	return callModel(t, r, request)
+}
+
+func callModel(t *testing.T, m engine.Model, request types.CompletionRequest) (*types.CompletionMessage, []types.CompletionStatus, error) {
+	t.Helper()
+
+	var (
+		status = make(chan types.CompletionStatus)
+		result []types.CompletionStatus
+		done   = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for s := range status {
+			result = append(result, s)
+		}
+	}()
+
+	resp, err := m.Call(context.Background(), request, status)
+	close(status)
+	<-done
+	return resp, result, err
+}
+
+func TestCallFallback(t *testing.T) {
+	client := &testClient{
+		models: map[string]error{
+			"primary":  &ErrModelUnavailable{Err: errors.New("rate limited")},
+			"fallback": nil,
+		},
+	}
+	r := NewRegistry()
+	require.NoError(t, r.AddClient(client))
+
+	resp, status, err := call(t, r, types.CompletionRequest{
+		Model:          "primary",
+		ModelFallbacks: []string{"fallback"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "answered by fallback", resp.String())
+	assert.Equal(t, []string{"primary", "fallback"}, client.calls)
+	require.Len(t, status, 1)
+	assert.Equal(t, "fallback", status[0].Model)
+}
+
+func TestCallDefaultFallback(t *testing.T) {
+	client := &testClient{
+		models: map[string]error{
+			"primary":  &ErrModelUnavailable{Err: errors.New("context length exceeded")},
+			"fallback": &ErrModelUnavailable{Err: errors.New("overloaded")},
+		},
+	}
+	r := NewRegistry()
+	r.SetDefaultFallbacks([]string{"primary", "fallback"})
+	require.NoError(t, r.AddClient(client))
+
+	_, _, err := call(t, r, types.CompletionRequest{
+		Model: "primary",
+	})
+	assert.Equal(t, []string{"primary", "fallback"}, client.calls)
+	require.ErrorContains(t, err, "model primary: context length exceeded")
+	require.ErrorContains(t, err, "model fallback: overloaded")
+
+	client.calls = nil
+	_, _, err = call(t, r, types.CompletionRequest{
+		Model:          "primary",
+		ModelFallbacks: []string{"missing"},
+	})
+	assert.Equal(t, []string{"primary"}, client.calls)
+	require.ErrorContains(t, err, "failed to find a model provider for model [missing]")
+}
+
+func TestCallNoFallback(t *testing.T) {
+	client := &testClient{
+		models: map[string]error{
+			"primary":     errors.New("invalid api key"),
+			"unavailable": &ErrModelUnavailable{Err: errors.New("overloaded")},
+			"fallback":    nil,
+		},
+	}
+	r := NewRegistry()
+	require.NoError(t, r.AddClient(client))
+
+	// Errors that another model would also have are returned as is
+	_, _, err := call(t, r, types.CompletionRequest{
+		Model:          "primary",
+		ModelFallbacks: []string{"fallback"},
+	})
+	require.EqualError(t, err, "invalid api key")
+	assert.Equal(t, []string{"primary"}, client.calls)
+
+	// Nothing is tried once the context is done
+	client.calls = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.Call(ctx, types.CompletionRequest{
+		Model:          "unavailable",
+		ModelFallbacks: []string{"fallback"},
+	}, nil)
+	require.EqualError(t, err, "overloaded")
+	assert.Equal(t, []string{"unavailable"}, client.calls)
+
+	// A fallback that is not found is skipped
+	client.calls = nil
+	resp, _, err := call(t, r, types.CompletionRequest{
+		Model:          "unavailable",
+		ModelFallbacks: []string{"missing", "fallback"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "answered by fallback", resp.String())
+	assert.Equal(t, []string{"unavailable", "fallback"}, client.calls)
+}
+
+func TestCallAlias(t *testing.T) {
+	var (
+		client = &testClient{
+			models: map[string]error{
+				"gpt-4o-mini": nil,
+			},
+		}
+		aliasClient = &testClient{
+			models: map[string]error{
+				"o1": nil,
+			},
+		}
+		temperature = float32(0.5)
+	)
+	r := NewRegistry()
+	require.NoError(t, r.AddClient(client))
+	r.SetAlias("fast", Alias{
+		Model:     "gpt-4o-mini",
+		MaxTokens: 100,
+	})
+	r.SetAlias("reasoning", Alias{
+		Model:       "o1",
+		Client:      aliasClient,
+		Temperature: &temperature,
+	})
+
+	resp, status, err := call(t, r, types.CompletionRequest{
+		Model: "fast",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "answered by gpt-4o-mini", resp.String())
+	require.Len(t, status, 1)
+	assert.Equal(t, "gpt-4o-mini", status[0].Model)
+
+	resp, _, err = call(t, r, types.CompletionRequest{
+		Model:          "reasoning",
+		ModelFallbacks: []string{"fast"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "answered by o1", resp.String())
+	assert.Equal(t, []string{"gpt-4o-mini"}, client.calls)
+	assert.Equal(t, []string{"o1"}, aliasClient.calls)
+
+	models, err := r.ListModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fast", "reasoning"}, models)
+}
+
+func TestCallModelProvider(t *testing.T) {
+	var (
+		first = &testClient{
+			models: map[string]error{
+				"shared": nil,
+			},
+		}
+		second = &testClient{
+			models: map[string]error{},
+		}
+	)
+	r := NewRegistry()
+	require.NoError(t, r.AddClient(first))
+	require.NoError(t, r.AddClient(second))
+	r.SetModelProvider("shared", second)
+
+	resp, _, err := call(t, r, types.CompletionRequest{
+		Model: "shared",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "answered by shared", resp.String())
+	assert.Empty(t, first.calls)
+	assert.Equal(t, []string{"shared"}, second.calls)
+}
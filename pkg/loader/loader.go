@@ -120,8 +120,19 @@ func readTool(ctx context.Context, prg *types.Program, base *source, targetToolN
 		return loadProgram(data, prg, targetToolName)
 	}
 
-	var tools []types.Tool
-	if isOpenAPI(data) {
+	var (
+		tools  []types.Tool
+		format = parser.FormatOf(base.Name)
+	)
+	if format != parser.FormatGPT {
+		doc, err := parser.ParseFormat(bytes.NewReader(data), format, parser.Options{
+			AssignGlobals: true,
+		})
+		if err != nil {
+			return types.Tool{}, err
+		}
+		tools = doc.Tools()
+	} else if isOpenAPI(data) {
 		if t, err := openapi3.NewLoader().LoadFromData(data); err == nil {
 			if base.Remote {
 				tools, err = getOpenAPITools(t, base.Location)
@@ -134,7 +145,9 @@ func readTool(ctx context.Context, prg *types.Program, base *source, targetToolN
 		}
 	}
 
-	if ext := path.Ext(base.Name); len(tools) == 0 && ext != "" && ext != system.Suffix && utf8.Valid(data) {
+	// Markdown without any gptscript blocks is printed as is
+	if ext := path.Ext(base.Name); len(tools) == 0 && (format == parser.FormatGPT || format == parser.FormatMarkdown) &&
+		ext != "" && ext != system.Suffix && utf8.Valid(data) {
 		tools = []types.Tool{
 			{
 				Parameters: types.Parameters{
@@ -146,7 +159,7 @@ func readTool(ctx context.Context, prg *types.Program, base *source, targetToolN
 	}
 
 	// If we didn't get any tools from trying to parse it as OpenAPI, try to parse it as a GPTScript
-	if len(tools) == 0 {
+	if len(tools) == 0 && format == parser.FormatGPT {
 		tools, err = parser.ParseTools(bytes.NewReader(data), parser.Options{
 			AssignGlobals: true,
 		})
@@ -248,6 +261,14 @@ func link(ctx context.Context, prg *types.Program, base *source, tool types.Tool
 		tool.LocalTools[strings.ToLower(localTool.Parameters.Name)] = localTool.ID
 	}
 
+	if tool.Parameters.OutputSchemaRef != "" && tool.Parameters.OutputSchema == nil {
+		schema, err := readOutputSchema(ctx, base, tool.Parameters.OutputSchemaRef)
+		if err != nil {
+			return types.Tool{}, parser.NewErrLine(tool.Source.Location, tool.Source.LineNo, err)
+		}
+		tool.Parameters.OutputSchema = schema
+	}
+
 	tool = builtin.SetDefaults(tool)
 	prg.ToolSet[tool.ID] = tool
 
@@ -285,6 +306,22 @@ func Program(ctx context.Context, name, subToolName string) (types.Program, erro
 	return prg, nil
 }
 
+// ProgramFromReference loads the tool a reference in a file of dir points to, the same way the references of
+// the file are resolved when it is linked.
+func ProgramFromReference(ctx context.Context, dir, ref string) (types.Program, error) {
+	name, subToolName := SplitToolRef(ref)
+	prg := types.Program{
+		Name:    name,
+		ToolSet: types.ToolSet{},
+	}
+	tool, err := resolve(ctx, &prg, &source{Path: dir}, name, subToolName)
+	if err != nil {
+		return types.Program{}, err
+	}
+	prg.EntryToolID = tool.ID
+	return prg, nil
+}
+
 func resolve(ctx context.Context, prg *types.Program, base *source, name, subTool string) (types.Tool, error) {
 	if subTool == "" {
 		t, ok := builtin.Builtin(name)
@@ -322,6 +359,37 @@ func input(ctx context.Context, base *source, name string) (*source, error) {
 	return nil, fmt.Errorf("can not load tools path=%s name=%s", base.Path, name)
 }
 
+func readOutputSchema(ctx context.Context, base *source, name string) (*openapi3.Schema, error) {
+	// input marks the base as remote when loading a URL, which must not leak to the tools loaded after
+	baseCopy := *base
+	s, err := input(ctx, &baseCopy, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load output schema %s: %w", name, err)
+	}
+
+	data, err := io.ReadAll(s.Content)
+	_ = s.Content.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output schema %s: %w", name, err)
+	}
+
+	if !json.Valid(data) {
+		var obj any
+		if err := yaml.Unmarshal(data, &obj); err != nil {
+			return nil, fmt.Errorf("failed to parse output schema %s: %w", name, err)
+		}
+		if data, err = json.Marshal(obj); err != nil {
+			return nil, fmt.Errorf("failed to parse output schema %s: %w", name, err)
+		}
+	}
+
+	schema := &openapi3.Schema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("failed to parse output schema %s: %w", name, err)
+	}
+	return schema, nil
+}
+
 func SplitToolRef(targetToolName string) (toolName, subTool string) {
 	var (
 		fields = strings.Fields(targetToolName)
@@ -3,6 +3,8 @@ package loader
 import (
 	"context"
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -107,3 +109,43 @@ func TestParse(t *testing.T) {
 	tool, subTool = SplitToolRef("a with x")
 	autogold.Expect([]string{"a", ""}).Equal(t, []string{tool, subTool})
 }
+
+func TestStructuredFormats(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.gpt.json"), []byte(`{"tools": [{"instructions": "Other"}]}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.gpt.yaml"), []byte(`tools:
+- tools: [helper, ./other.gpt.json]
+  instructions: Main
+- name: helper
+  arguments:
+    type: object
+    properties:
+      name: {type: string}
+  instructions: Help ${name}
+`), 0644))
+
+	prg, err := Program(context.Background(), filepath.Join(dir, "main.gpt.yaml"), "")
+	require.NoError(t, err)
+
+	main := prg.ToolSet[prg.EntryToolID]
+	require.Equal(t, "Main", main.Instructions)
+	helper := prg.ToolSet[main.ToolMapping["helper"]]
+	require.Equal(t, "Help ${name}", helper.Instructions)
+	require.Equal(t, "string", helper.Arguments.Properties["name"].Value.Type)
+	require.Equal(t, "Other", prg.ToolSet[main.ToolMapping["./other.gpt.json"]].Instructions)
+}
+
+func TestMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.md"), []byte("# Notes\n\nJust prose\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Main\n\n```gptscript\n"+
+		"tools: helper, ./notes.md\n\nMain\n```\n\n## Helper\n\n```gptscript\n#!sys.echo\n```\n"), 0644))
+
+	prg, err := Program(context.Background(), filepath.Join(dir, "README.md"), "")
+	require.NoError(t, err)
+
+	main := prg.ToolSet[prg.EntryToolID]
+	require.Equal(t, "Main", main.Name)
+	require.Equal(t, "#!sys.echo", prg.ToolSet[main.ToolMapping["helper"]].Instructions)
+	require.True(t, prg.ToolSet[main.ToolMapping["./notes.md"]].IsPrint())
+}
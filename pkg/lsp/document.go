@@ -0,0 +1,268 @@
+package lsp
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gptscript-ai/gptscript/pkg/parser"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+var (
+	sepRegex       = regexp.MustCompile(`^\s*---+\s*$`)
+	strictSepRegex = regexp.MustCompile(`^---$`)
+	skipRegex      = regexp.MustCompile(`^![-\w]+\s*$`)
+)
+
+// document is an open .gpt file, split into the lines of its tools the same way the parser reads them.
+type document struct {
+	uri     string
+	version int
+	text    string
+	lines   []string
+	tools   []*toolSpan
+}
+
+// toolSpan is the lines of one tool of a document.
+type toolSpan struct {
+	name string
+	// start and end are the first and last lines of the tool, nameLine the line of its name if it has one
+	start, end, nameLine int
+	// body is the first line of the instructions, or the line after the end if there are none
+	body   int
+	params []param
+}
+
+// param is a "Key: value" line of the header of a tool.
+type param struct {
+	line int
+	// key and value are byte offsets in the line
+	keyStart, keyEnd, valueStart int
+	value                        string
+	directive                    parser.Directive
+}
+
+// toolRef is one of the tool references of a param.
+type toolRef struct {
+	ref        string
+	line       int
+	start, end int
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{
+		uri:     uri,
+		version: version,
+		text:    text,
+		lines:   strings.Split(text, "\n"),
+	}
+	d.scan()
+	return d
+}
+
+// scan follows the rules of parser.Parse to find where the tools, their params and their bodies are.
+func (d *document) scan() {
+	var (
+		current  = &toolSpan{nameLine: -1, body: -1}
+		skipNode bool
+		seen     bool
+	)
+
+	finish := func(end int) {
+		if current.body == -1 {
+			current.body = end + 1
+		}
+		current.end = end
+		if !skipNode && (current.name != "" || len(current.params) > 0 || current.body <= end) {
+			d.tools = append(d.tools, current)
+		}
+		current = &toolSpan{start: end + 2, nameLine: -1, body: -1}
+		skipNode, seen = false, false
+	}
+
+	for i, line := range d.lines {
+		line = strings.TrimSuffix(line, "\r")
+		if (skipNode && strictSepRegex.MatchString(line)) || (!skipNode && sepRegex.MatchString(line)) {
+			finish(i - 1)
+			continue
+		}
+		if skipNode || current.body != -1 {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#!") && i == 0:
+		case strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "#!"):
+		case !seen && skipRegex.MatchString(line):
+			skipNode = true
+		case strings.TrimSpace(line) == "":
+		default:
+			p, ok := newParam(i, line)
+			if !ok {
+				current.body = i
+				continue
+			}
+			seen = true
+			if p.directive.Name == "Name" {
+				current.name, current.nameLine = p.value, i
+			}
+			current.params = append(current.params, p)
+		}
+	}
+
+	finish(len(d.lines) - 1)
+}
+
+func newParam(lineNo int, line string) (param, bool) {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return param{}, false
+	}
+	directive, ok := parser.LookupDirective(key)
+	if !ok {
+		return param{}, false
+	}
+
+	keyStart := len(key) - len(strings.TrimLeft(key, " \t"))
+	valueStart := len(key) + 1 + len(value) - len(strings.TrimLeft(value, " \t"))
+	return param{
+		line:       lineNo,
+		keyStart:   keyStart,
+		keyEnd:     len(strings.TrimRight(key, " \t")),
+		valueStart: valueStart,
+		value:      strings.TrimSpace(value),
+		directive:  directive,
+	}, true
+}
+
+// refs returns the tool references in the value of a param.
+func (p param) refs() (result []toolRef) {
+	if !p.directive.ToolRefs {
+		return nil
+	}
+
+	offset := p.valueStart
+	for _, part := range strings.Split(p.value, ",") {
+		ref := strings.TrimSpace(part)
+		if ref != "" {
+			start := offset + strings.Index(part, ref)
+			result = append(result, toolRef{
+				ref:   ref,
+				line:  p.line,
+				start: start,
+				end:   start + len(ref),
+			})
+		}
+		offset += len(part) + 1
+	}
+	return
+}
+
+// tool returns the tool at a line.
+func (d *document) tool(line int) *toolSpan {
+	for _, tool := range d.tools {
+		if line >= tool.start && line <= tool.end {
+			return tool
+		}
+	}
+	return nil
+}
+
+// localTool returns the tool of the document a reference points to, if any.
+func (d *document) localTool(ref string) *toolSpan {
+	name, _ := types.SplitArg(ref)
+	for _, tool := range d.tools {
+		if tool.name != "" && strings.EqualFold(tool.name, name) {
+			return tool
+		}
+	}
+	return nil
+}
+
+// paramAt returns the param at a position and the byte offset of the position in its line.
+func (d *document) paramAt(pos Position) (param, int, bool) {
+	tool := d.tool(pos.Line)
+	if tool == nil {
+		return param{}, 0, false
+	}
+	for _, p := range tool.params {
+		if p.line == pos.Line {
+			return p, d.offset(pos), true
+		}
+	}
+	return param{}, 0, false
+}
+
+// refAt returns the tool reference at a position.
+func (d *document) refAt(pos Position) (toolRef, bool) {
+	p, offset, ok := d.paramAt(pos)
+	if !ok {
+		return toolRef{}, false
+	}
+	for _, ref := range p.refs() {
+		if offset >= ref.start && offset <= ref.end {
+			return ref, true
+		}
+	}
+	return toolRef{}, false
+}
+
+func (d *document) line(line int) string {
+	if line < 0 || line >= len(d.lines) {
+		return ""
+	}
+	return strings.TrimSuffix(d.lines[line], "\r")
+}
+
+// offset converts the UTF-16 character of a position to a byte offset in its line.
+func (d *document) offset(pos Position) int {
+	line := d.line(pos.Line)
+	var units int
+	for i, r := range line {
+		if units >= pos.Character {
+			return i
+		}
+		units += utf16Len(r)
+	}
+	return len(line)
+}
+
+// position converts a byte offset in a line to a position.
+func (d *document) position(line, offset int) Position {
+	text := d.line(line)
+	offset = min(offset, len(text))
+
+	var units int
+	for i := 0; i < offset; {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		units += utf16Len(r)
+		i += size
+	}
+	return Position{
+		Line:      line,
+		Character: units,
+	}
+}
+
+func (d *document) lineRange(line int) Range {
+	return Range{
+		Start: d.position(line, 0),
+		End:   d.position(line, len(d.line(line))),
+	}
+}
+
+func (d *document) rangeOf(line, start, end int) Range {
+	return Range{
+		Start: d.position(line, start),
+		End:   d.position(line, end),
+	}
+}
+
+// utf16Len is the number of UTF-16 code units of a rune, which LSP positions count in.
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,289 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/parser"
+)
+
+const diagnosticSource = "gptscript"
+
+func parseDiagnostics(doc *document) []Diagnostic {
+	_, err := parser.Parse(strings.NewReader(doc.text), parser.Options{
+		AssignGlobals: true,
+	})
+	if err == nil {
+		return nil
+	}
+
+	var (
+		line    int
+		message = err.Error()
+	)
+	if errLine := (*parser.ErrLine)(nil); errors.As(err, &errLine) {
+		line, message = errLine.Line-1, errLine.Err.Error()
+	}
+	return []Diagnostic{
+		{
+			Range:    doc.lineRange(line),
+			Severity: severityError,
+			Source:   diagnosticSource,
+			Message:  message,
+		},
+	}
+}
+
+// linkDiagnostics loads the tools referenced by the document that are not defined in it, the same way the
+// loader does when it links a program.
+func linkDiagnostics(ctx context.Context, doc *document) (result []Diagnostic) {
+	dir := documentDir(doc.uri)
+	for _, tool := range doc.tools {
+		for _, p := range tool.params {
+			for _, ref := range p.refs() {
+				if doc.localTool(ref.ref) != nil {
+					continue
+				}
+
+				// The parser lower cases references, so the loader does too
+				if _, err := loader.ProgramFromReference(ctx, dir, strings.ToLower(ref.ref)); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					result = append(result, Diagnostic{
+						Range:    doc.rangeOf(ref.line, ref.start, ref.end),
+						Severity: severityError,
+						Source:   diagnosticSource,
+						Message:  fmt.Sprintf("failed resolving %s: %v", ref.ref, err),
+					})
+				}
+			}
+		}
+	}
+	return
+}
+
+func hover(doc *document, pos Position) *Hover {
+	p, offset, ok := doc.paramAt(pos)
+	if !ok {
+		return nil
+	}
+
+	if offset >= p.keyStart && offset <= p.keyEnd {
+		r := doc.rangeOf(p.line, p.keyStart, p.keyEnd)
+		return &Hover{
+			Contents: MarkupContent{
+				Kind:  markupKindMarkdown,
+				Value: fmt.Sprintf("**%s**\n\n%s", p.directive.Name, p.directive.Description),
+			},
+			Range: &r,
+		}
+	}
+
+	ref, ok := doc.refAt(pos)
+	if !ok {
+		return nil
+	}
+	tool := doc.localTool(ref.ref)
+	if tool == nil {
+		return nil
+	}
+
+	value := fmt.Sprintf("**%s**", tool.name)
+	for _, p := range tool.params {
+		if p.directive.Name == "Description" {
+			value += "\n\n" + p.value
+		}
+	}
+	r := doc.rangeOf(ref.line, ref.start, ref.end)
+	return &Hover{
+		Contents: MarkupContent{
+			Kind:  markupKindMarkdown,
+			Value: value,
+		},
+		Range: &r,
+	}
+}
+
+func completion(doc *document, pos Position) []CompletionItem {
+	tool := doc.tool(pos.Line)
+	if tool == nil {
+		// A new tool after a separator or at the end of the document
+		if isDirectivePrefix(doc.line(pos.Line)[:doc.offset(pos)]) {
+			return directiveCompletions()
+		}
+		return nil
+	}
+
+	if p, offset, ok := doc.paramAt(pos); ok {
+		if offset > p.keyEnd && p.directive.ToolRefs {
+			return toolCompletions(doc, tool)
+		}
+		if offset <= p.keyEnd {
+			return directiveCompletions()
+		}
+		return nil
+	}
+
+	// A line being typed in the header, which the parser reads as the start of the body until it is a param
+	if pos.Line <= tool.body && isDirectivePrefix(doc.line(pos.Line)[:doc.offset(pos)]) {
+		return directiveCompletions()
+	}
+	return nil
+}
+
+// isDirectivePrefix returns if text could be the start of a directive, to tell a directive being typed
+// from instructions.
+func isDirectivePrefix(text string) bool {
+	prefix := strings.ToLower(strings.ReplaceAll(text, " ", ""))
+	for _, directive := range parser.Directives {
+		for _, key := range append([]string{directive.Name}, directive.Aliases...) {
+			if strings.HasPrefix(strings.ToLower(strings.ReplaceAll(key, " ", "")), prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func directiveCompletions() (result []CompletionItem) {
+	for _, directive := range parser.Directives {
+		result = append(result, CompletionItem{
+			Label: directive.Name,
+			Kind:  completionKindKeyword,
+			Documentation: &MarkupContent{
+				Kind:  markupKindMarkdown,
+				Value: directive.Description,
+			},
+			InsertText: directive.Name + ": ",
+		})
+	}
+	return
+}
+
+func toolCompletions(doc *document, current *toolSpan) (result []CompletionItem) {
+	for _, tool := range doc.tools {
+		if tool.name == "" || tool == current {
+			continue
+		}
+		result = append(result, CompletionItem{
+			Label: tool.name,
+			Kind:  completionKindFunction,
+		})
+	}
+	return
+}
+
+// definition finds the tool a reference points to, in the document or in a local file. Remote tools are not
+// downloaded.
+func definition(doc *document, pos Position) *Location {
+	ref, ok := doc.refAt(pos)
+	if !ok {
+		return nil
+	}
+
+	if tool := doc.localTool(ref.ref); tool != nil {
+		return toolLocation(doc, tool)
+	}
+
+	toolName, subTool := loader.SplitToolRef(ref.ref)
+	path := localPath(documentDir(doc.uri), toolName)
+	if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	target := newDocument(fileURI(path), 0, string(data))
+	if subTool == "" {
+		if len(target.tools) == 0 {
+			return nil
+		}
+		return toolLocation(target, target.tools[0])
+	}
+	if tool := target.localTool(subTool); tool != nil {
+		return toolLocation(target, tool)
+	}
+	return nil
+}
+
+func toolLocation(doc *document, tool *toolSpan) *Location {
+	line := tool.nameLine
+	if line == -1 {
+		line = tool.start
+	}
+	return &Location{
+		URI:   doc.uri,
+		Range: doc.lineRange(line),
+	}
+}
+
+func symbols(doc *document) []DocumentSymbol {
+	result := []DocumentSymbol{}
+	for _, tool := range doc.tools {
+		name := tool.name
+		if name == "" {
+			name = "(main)"
+		}
+		selection := tool.nameLine
+		if selection == -1 {
+			selection = tool.start
+		}
+		result = append(result, DocumentSymbol{
+			Name: name,
+			Kind: symbolKindFunction,
+			Range: Range{
+				Start: doc.position(tool.start, 0),
+				End:   doc.position(tool.end, len(doc.line(tool.end))),
+			},
+			SelectionRange: doc.lineRange(selection),
+		})
+	}
+	return result
+}
+
+// documentDir returns the directory of a file URI, or the working directory for other URIs.
+func documentDir(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	path := u.Path
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		// A Windows drive, as in file:///C:/dir/file.gpt
+		path = path[1:]
+	}
+	return filepath.Dir(filepath.FromSlash(path))
+}
+
+func fileURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// localPath returns the path of a tool reference relative to dir if it is a local file, or the reference as
+// is so the loader can look for it elsewhere.
+func localPath(dir, name string) string {
+	if dir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	return name
+}
@@ -0,0 +1,129 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  any              `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+// conn reads and writes JSON-RPC messages framed with a Content-Length header, as LSP does over stdio.
+type conn struct {
+	in        *textproto.Reader
+	writeLock sync.Mutex
+	out       io.Writer
+}
+
+func newConn(in io.Reader, out io.Writer) *conn {
+	return &conn{
+		in:  textproto.NewReader(bufio.NewReader(in)),
+		out: out,
+	}
+}
+
+func (c *conn) read() (*message, error) {
+	header, err := c.in.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header: %w", err)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.in.R, data); err != nil {
+		return nil, err
+	}
+
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, &responseError{
+			Code:    codeParseError,
+			Message: err.Error(),
+		}
+	}
+	return &msg, nil
+}
+
+func (c *conn) write(msg message) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if _, err := fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = c.out.Write(data)
+	return err
+}
+
+func (c *conn) reply(id *json.RawMessage, result any, err error) error {
+	if err == nil {
+		if result == nil {
+			// A successful response must have a result, even if it is null
+			result = json.RawMessage("null")
+		}
+		return c.write(message{
+			ID:     id,
+			Result: result,
+		})
+	}
+
+	var respErr *responseError
+	if !errors.As(err, &respErr) {
+		respErr = &responseError{
+			Code:    codeInternalError,
+			Message: err.Error(),
+		}
+	}
+	return c.write(message{
+		ID:    id,
+		Error: respErr,
+	})
+}
+
+func (c *conn) notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.write(message{
+		Method: method,
+		Params: data,
+	})
+}
@@ -0,0 +1,226 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/version"
+)
+
+// Server is a language server for .gpt files that speaks LSP over a reader and writer, usually stdio.
+type Server struct {
+	conn *conn
+	lock sync.Mutex
+	docs map[string]*document
+	// linking tracks the running link checks so Serve can wait for them
+	linking sync.WaitGroup
+}
+
+func NewServer() *Server {
+	return &Server{
+		docs: map[string]*document{},
+	}
+}
+
+// Serve answers requests from in until the client sends exit or in is closed.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		s.linking.Wait()
+	}()
+
+	s.conn = newConn(in, out)
+	for {
+		msg, err := s.conn.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if respErr := (*responseError)(nil); errors.As(err, &respErr) {
+			if err := s.conn.reply(nil, nil, respErr); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, err := s.handle(ctx, msg)
+		if msg.ID == nil {
+			if err != nil {
+				log.Debugf("failed to handle %s: %v", msg.Method, err)
+			}
+			continue
+		}
+		if err := s.conn.reply(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+func decode[T any](params json.RawMessage) (T, error) {
+	var result T
+	if err := json.Unmarshal(params, &result); err != nil {
+		return result, &responseError{
+			Code:    codeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+	return result, nil
+}
+
+func (s *Server) handle(ctx context.Context, msg *message) (any, error) {
+	switch msg.Method {
+	case "initialize":
+		return s.initialize(), nil
+	case "initialized", "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		params, err := decode[DidOpenTextDocumentParams](msg.Params)
+		if err != nil {
+			return nil, err
+		}
+		doc := s.open(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
+		return nil, s.publish(ctx, doc, true)
+	case "textDocument/didChange":
+		params, err := decode[DidChangeTextDocumentParams](msg.Params)
+		if err != nil || len(params.ContentChanges) == 0 {
+			return nil, err
+		}
+		// The server asks for full syncs, so the last change is the whole document
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		doc := s.open(params.TextDocument.URI, params.TextDocument.Version, text)
+		return nil, s.publish(ctx, doc, false)
+	case "textDocument/didSave":
+		params, err := decode[DidSaveTextDocumentParams](msg.Params)
+		if err != nil {
+			return nil, err
+		}
+		if doc := s.get(params.TextDocument.URI); doc != nil {
+			return nil, s.publish(ctx, doc, true)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		params, err := decode[DidCloseTextDocumentParams](msg.Params)
+		if err != nil {
+			return nil, err
+		}
+		s.lock.Lock()
+		delete(s.docs, params.TextDocument.URI)
+		s.lock.Unlock()
+		return nil, s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+	case "textDocument/hover":
+		return withDocument(s, msg.Params, hover)
+	case "textDocument/completion":
+		return withDocument(s, msg.Params, completion)
+	case "textDocument/definition":
+		return withDocument(s, msg.Params, definition)
+	case "textDocument/documentSymbol":
+		params, err := decode[DocumentSymbolParams](msg.Params)
+		if err != nil {
+			return nil, err
+		}
+		doc := s.get(params.TextDocument.URI)
+		if doc == nil {
+			return nil, nil
+		}
+		return symbols(doc), nil
+	default:
+		return nil, &responseError{
+			Code:    codeMethodNotFound,
+			Message: fmt.Sprintf("method %s is not supported", msg.Method),
+		}
+	}
+}
+
+func withDocument[T any](s *Server, params json.RawMessage, f func(*document, Position) T) (any, error) {
+	p, err := decode[TextDocumentPositionParams](params)
+	if err != nil {
+		return nil, err
+	}
+	doc := s.get(p.TextDocument.URI)
+	if doc == nil {
+		return nil, nil
+	}
+	return f(doc, p.Position), nil
+}
+
+func (s *Server) initialize() InitializeResult {
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync: TextDocumentSyncOptions{
+				OpenClose: true,
+				Change:    syncFull,
+				Save:      true,
+			},
+			HoverProvider: true,
+			CompletionProvider: CompletionOptions{
+				TriggerCharacters: []string{","},
+			},
+			DefinitionProvider:     true,
+			DocumentSymbolProvider: true,
+		},
+		ServerInfo: ServerInfo{
+			Name:    "gptscript",
+			Version: version.Get().String(),
+		},
+	}
+}
+
+func (s *Server) open(uri string, version int, text string) *document {
+	doc := newDocument(uri, version, text)
+	s.lock.Lock()
+	s.docs[uri] = doc
+	s.lock.Unlock()
+	return doc
+}
+
+func (s *Server) get(uri string) *document {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.docs[uri]
+}
+
+// publish sends the parse errors of a document. The link errors need to load the referenced tools, which
+// may be remote, so they are only checked when the document is opened or saved, in the background.
+func (s *Server) publish(ctx context.Context, doc *document, link bool) error {
+	diagnostics := parseDiagnostics(doc)
+	if err := s.send(doc, diagnostics); err != nil || !link {
+		return err
+	}
+
+	s.linking.Add(1)
+	go func() {
+		defer s.linking.Done()
+		linkErrors := linkDiagnostics(ctx, doc)
+		if len(linkErrors) == 0 || ctx.Err() != nil || s.get(doc.uri) != doc {
+			// The document changed since, its new diagnostics were already sent
+			return
+		}
+		if err := s.send(doc, append(diagnostics, linkErrors...)); err != nil {
+			log.Debugf("failed to publish diagnostics of %s: %v", doc.uri, err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) send(doc *document, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	return s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         doc.uri,
+		Version:     doc.version,
+		Diagnostics: diagnostics,
+	})
+}
@@ -0,0 +1,207 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testScript = `tools: helper, ./other.gpt, sub from ./other.gpt, ./nope.gpt, sys.read
+args: name: who to greet
+
+Greet ${name}
+
+---
+name: helper
+description: Helps out
+maxtokens: lots
+
+Help
+`
+
+type session struct {
+	in     bytes.Buffer
+	nextID int
+}
+
+func (s *session) send(method string, params any) int {
+	s.nextID++
+	s.write(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      s.nextID,
+		"method":  method,
+		"params":  params,
+	})
+	return s.nextID
+}
+
+func (s *session) notify(method string, params any) {
+	s.write(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+}
+
+func (s *session) write(msg any) {
+	data, _ := json.Marshal(msg)
+	_, _ = fmt.Fprintf(&s.in, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+type reply struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+func (s *session) run(t *testing.T) (results map[int]reply, diagnostics []PublishDiagnosticsParams) {
+	var out bytes.Buffer
+	require.NoError(t, NewServer().Serve(context.Background(), &s.in, &out))
+
+	results = map[int]reply{}
+	r := textproto.NewReader(bufio.NewReader(&out))
+	for {
+		header, err := r.ReadMIMEHeader()
+		if err != nil {
+			break
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		require.NoError(t, err)
+		data := make([]byte, length)
+		_, err = io.ReadFull(r.R, data)
+		require.NoError(t, err)
+
+		var msg reply
+		require.NoError(t, json.Unmarshal(data, &msg))
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var params PublishDiagnosticsParams
+			require.NoError(t, json.Unmarshal(msg.Params, &params))
+			diagnostics = append(diagnostics, params)
+		} else {
+			results[msg.ID] = msg
+		}
+	}
+	return
+}
+
+func position(uri string, line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     Position{Line: line, Character: character},
+	}
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.gpt"), []byte("Other\n---\nname: sub\n\nSub\n"), 0644))
+	path := filepath.Join(dir, "main.gpt")
+	uri := fileURI(path)
+
+	var s session
+	initialize := s.send("initialize", map[string]any{})
+	s.notify("initialized", map[string]any{})
+	s.notify("textDocument/didOpen", map[string]any{
+		"textDocument": TextDocumentItem{URI: uri, Version: 1, Text: testScript},
+	})
+	hoverKey := s.send("textDocument/hover", position(uri, 1, 1))
+	hoverRef := s.send("textDocument/hover", position(uri, 0, 9))
+	completeKey := s.send("textDocument/completion", position(uri, 2, 0))
+	completeBody := s.send("textDocument/completion", position(uri, 3, 5))
+	completeRef := s.send("textDocument/completion", position(uri, 0, 13))
+	defineLocal := s.send("textDocument/definition", position(uri, 0, 9))
+	defineFile := s.send("textDocument/definition", position(uri, 0, 16))
+	defineSub := s.send("textDocument/definition", position(uri, 0, 30))
+	symbols := s.send("textDocument/documentSymbol", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+	})
+	unknown := s.send("textDocument/rename", map[string]any{})
+	s.send("shutdown", nil)
+	s.notify("exit", nil)
+
+	results, diagnostics := s.run(t)
+
+	var initResult InitializeResult
+	require.NoError(t, json.Unmarshal(results[initialize].Result, &initResult))
+	assert.True(t, initResult.Capabilities.DefinitionProvider)
+	assert.Equal(t, syncFull, initResult.Capabilities.TextDocumentSync.Change)
+
+	var h Hover
+	require.NoError(t, json.Unmarshal(results[hoverKey].Result, &h))
+	assert.Contains(t, h.Contents.Value, "**Args**")
+	require.NoError(t, json.Unmarshal(results[hoverRef].Result, &h))
+	assert.Equal(t, "**helper**\n\nHelps out", h.Contents.Value)
+
+	var items []CompletionItem
+	require.NoError(t, json.Unmarshal(results[completeKey].Result, &items))
+	assert.NotEmpty(t, items)
+	require.NoError(t, json.Unmarshal(results[completeBody].Result, &items))
+	assert.Empty(t, items)
+	require.NoError(t, json.Unmarshal(results[completeRef].Result, &items))
+	require.Len(t, items, 1)
+	assert.Equal(t, "helper", items[0].Label)
+
+	var loc Location
+	require.NoError(t, json.Unmarshal(results[defineLocal].Result, &loc))
+	assert.Equal(t, Location{URI: uri, Range: Range{End: Position{Line: 6, Character: 12}, Start: Position{Line: 6}}}, loc)
+	require.NoError(t, json.Unmarshal(results[defineFile].Result, &loc))
+	assert.Equal(t, fileURI(filepath.Join(dir, "other.gpt")), loc.URI)
+	assert.Equal(t, 0, loc.Range.Start.Line)
+	require.NoError(t, json.Unmarshal(results[defineSub].Result, &loc))
+	assert.Equal(t, 2, loc.Range.Start.Line)
+
+	var syms []DocumentSymbol
+	require.NoError(t, json.Unmarshal(results[symbols].Result, &syms))
+	require.Len(t, syms, 2)
+	assert.Equal(t, "(main)", syms[0].Name)
+	assert.Equal(t, Range{End: Position{Line: 4}}, syms[0].Range)
+	assert.Equal(t, "helper", syms[1].Name)
+	assert.Equal(t, 6, syms[1].SelectionRange.Start.Line)
+
+	require.NotNil(t, results[unknown].Error)
+	assert.Equal(t, codeMethodNotFound, results[unknown].Error.Code)
+
+	// The link errors are checked in the background and may be canceled by the exit
+	require.NotEmpty(t, diagnostics)
+	require.Len(t, diagnostics[0].Diagnostics, 1)
+	assert.Equal(t, 8, diagnostics[0].Diagnostics[0].Range.Start.Line)
+	assert.Contains(t, diagnostics[0].Diagnostics[0].Message, `parsing "lots"`)
+
+	linkErrors := linkDiagnostics(context.Background(), newDocument(uri, 1, testScript))
+	require.Len(t, linkErrors, 1)
+	assert.Contains(t, linkErrors[0].Message, "failed resolving ./nope.gpt")
+	assert.Equal(t, Range{Start: Position{Character: 50}, End: Position{Character: 60}}, linkErrors[0].Range)
+}
+
+func TestCompletionInHeader(t *testing.T) {
+	doc := newDocument("file:///test.gpt", 1, "name: test\nMod\n\nBody\n")
+	items := completion(doc, Position{Line: 1, Character: 3})
+	assert.NotEmpty(t, items)
+	assert.Equal(t, "Name", items[0].Label)
+	assert.Equal(t, "Name: ", items[0].InsertText)
+
+	assert.Empty(t, completion(doc, Position{Line: 3, Character: 2}))
+
+	doc = newDocument("file:///test.gpt", 1, "name: test\n\nGreet everyone\n")
+	assert.Empty(t, completion(doc, Position{Line: 2, Character: 5}))
+}
+
+func TestPositions(t *testing.T) {
+	doc := newDocument("file:///test.gpt", 1, "tools: 😀x, y\n")
+	ref, ok := doc.refAt(Position{Line: 0, Character: 12})
+	require.True(t, ok)
+	assert.Equal(t, "y", ref.ref)
+	assert.Equal(t, Position{Line: 0, Character: 12}, doc.position(0, ref.start))
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -246,6 +247,7 @@ func (d *display) Event(event runner.Event) {
 		if event.ChatRequest == nil {
 			log = log.Fields(
 				"completionID", event.ChatCompletionID,
+				"model", event.ChatModel,
 				"response", toJSON(event.ChatResponse),
 				"cached", event.ChatResponseCached,
 			)
@@ -253,9 +255,15 @@ func (d *display) Event(event runner.Event) {
 			log.Infof("sent     [%s]", callName)
 			log = log.Fields(
 				"completionID", event.ChatCompletionID,
+				"model", event.ChatModel,
 				"request", toJSON(event.ChatRequest),
 			)
 		}
+		if event.Usage != nil {
+			log = log.Fields("usage", *event.Usage)
+			currentCall.Usage = currentCall.Usage.Add(*event.Usage)
+			d.dump.Usage = d.dump.Usage.Add(*event.Usage)
+		}
 		if d.printMessages {
 			log.Infof("messages")
 		} else {
@@ -266,7 +274,13 @@ func (d *display) Event(event runner.Event) {
 			Request:      event.ChatRequest,
 			Response:     event.ChatResponse,
 			Cached:       event.ChatResponseCached,
+			Model:        event.ChatModel,
+			Usage:        event.Usage,
 		})
+	case runner.EventTypeCallRetry:
+		d.livePrinter.end()
+		log.Fields("completionID", event.ChatCompletionID).Infof("retry    [%s] attempt %d of %d in %s: %s",
+			callName, event.Retry.Attempt, event.Retry.MaxRetries, event.Retry.Delay.Round(time.Millisecond), event.Content)
 	case runner.EventTypeCallFinish:
 		d.livePrinter.progressEnd(currentCall)
 		d.livePrinter.end()
@@ -283,6 +297,7 @@ func (d *display) Stop(output string, err error) {
 	defer d.callLock.Unlock()
 
 	log.Fields("runID", d.dump.ID, "output", output, "err", err).Debugf("Run stopped")
+	d.printUsage()
 	d.dump.Output = output
 	d.dump.Err = err
 	if d.dumpState != "" {
@@ -294,6 +309,42 @@ func (d *display) Stop(output string, err error) {
 	}
 }
 
+// printUsage prints the token usage of the run broken down by tool
+func (d *display) printUsage() {
+	if d.dump.Usage.IsZero() {
+		return
+	}
+
+	byTool := d.usageByTool()
+	names := make([]string, 0, len(byTool))
+	for name := range byTool {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		log.Infof("usage    [%s] %s", name, byTool[name])
+	}
+	log.Infof("usage    [total] %s", d.dump.Usage)
+}
+
+// usageByTool returns the usage of the completions of the calls of each tool.
+func (d *display) usageByTool() map[string]types.Usage {
+	byTool := map[string]types.Usage{}
+	for _, call := range d.dump.Calls {
+		if call.Usage.IsZero() {
+			continue
+		}
+		name := call.ToolID
+		if d.dump.Program != nil {
+			tool := d.dump.Program.ToolSet[call.ToolID]
+			name = types.FirstSet(tool.Parameters.Name, tool.Source.Location, call.ToolID)
+		}
+		byTool[name] = byTool[name].Add(call.Usage)
+	}
+	return byTool
+}
+
 func NewConsole(opts ...Options) *Console {
 	opt := complete(opts...)
 	return &Console{
@@ -412,13 +463,16 @@ type dump struct {
 	Input   string         `json:"input,omitempty"`
 	Output  string         `json:"output,omitempty"`
 	Err     error          `json:"err,omitempty"`
+	Usage   types.Usage    `json:"usage,omitempty"`
 }
 
 type message struct {
-	CompletionID string `json:"completionID,omitempty"`
-	Request      any    `json:"request,omitempty"`
-	Response     any    `json:"response,omitempty"`
-	Cached       bool   `json:"cached,omitempty"`
+	CompletionID string       `json:"completionID,omitempty"`
+	Request      any          `json:"request,omitempty"`
+	Response     any          `json:"response,omitempty"`
+	Cached       bool         `json:"cached,omitempty"`
+	Model        string       `json:"model,omitempty"`
+	Usage        *types.Usage `json:"usage,omitempty"`
 }
 
 type call struct {
@@ -430,6 +484,8 @@ type call struct {
 	End      time.Time `json:"end,omitempty"`
 	Input    string    `json:"input,omitempty"`
 	Output   string    `json:"output,omitempty"`
+	// Usage is the usage of the completions made directly by this call, not including sub calls
+	Usage types.Usage `json:"usage,omitempty"`
 }
 
 func (c call) String() string {
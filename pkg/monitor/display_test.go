@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func callContext(id, parentID, toolID string) *engine.CallContext {
+	callCtx := &engine.CallContext{
+		ParentID: parentID,
+	}
+	callCtx.ID = id
+	callCtx.Tool.ID = toolID
+	return callCtx
+}
+
+func TestDisplayUsage(t *testing.T) {
+	prg := &types.Program{
+		ToolSet: types.ToolSet{
+			"main.gpt:":    {Source: types.ToolSource{Location: "main.gpt"}},
+			"main.gpt:bob": {Parameters: types.Parameters{Name: "bob"}},
+		},
+	}
+	mon, err := NewConsole().Start(context.Background(), prg, nil, "")
+	require.NoError(t, err)
+	d := mon.(*display)
+
+	root := callContext("1", "", "main.gpt:")
+	bob := callContext("2", "1", "main.gpt:bob")
+	bobAgain := callContext("3", "1", "main.gpt:bob")
+	for _, event := range []runner.Event{
+		{CallContext: root, Type: runner.EventTypeCallStart},
+		{CallContext: root, Type: runner.EventTypeChat, Usage: &types.Usage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110}},
+		{CallContext: bob, Type: runner.EventTypeCallStart},
+		{CallContext: bob, Type: runner.EventTypeChat, Usage: &types.Usage{PromptTokens: 50, CompletionTokens: 5, CachedTokens: 20, TotalTokens: 55}},
+		{CallContext: bob, Type: runner.EventTypeCallFinish, Usage: &types.Usage{PromptTokens: 50, CompletionTokens: 5, CachedTokens: 20, TotalTokens: 55}},
+		{CallContext: bobAgain, Type: runner.EventTypeCallStart},
+		{CallContext: bobAgain, Type: runner.EventTypeChat, Usage: &types.Usage{PromptTokens: 50, CompletionTokens: 5, TotalTokens: 55}},
+		{CallContext: bobAgain, Type: runner.EventTypeCallFinish, Usage: &types.Usage{PromptTokens: 50, CompletionTokens: 5, TotalTokens: 55}},
+		// A chat event without usage, as for a cached response
+		{CallContext: root, Type: runner.EventTypeChat},
+		{CallContext: root, Type: runner.EventTypeCallFinish, Usage: &types.Usage{PromptTokens: 200, CompletionTokens: 20, CachedTokens: 20, TotalTokens: 220}},
+	} {
+		d.Event(event)
+	}
+
+	// Each call only counts its own completions, so the calls add up to the whole run
+	assert.Equal(t, types.Usage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110}, d.dump.Calls[0].Usage)
+	assert.Equal(t, types.Usage{PromptTokens: 50, CompletionTokens: 5, CachedTokens: 20, TotalTokens: 55}, d.dump.Calls[1].Usage)
+	assert.Equal(t, types.Usage{PromptTokens: 200, CompletionTokens: 20, CachedTokens: 20, TotalTokens: 220}, d.dump.Usage)
+	assert.Equal(t, map[string]types.Usage{
+		"main.gpt": {PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110},
+		"bob":      {PromptTokens: 100, CompletionTokens: 10, CachedTokens: 20, TotalTokens: 110},
+	}, d.usageByTool())
+}
@@ -8,21 +8,26 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"slices"
 	"sort"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	openai "github.com/gptscript-ai/chat-completion-client"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
 	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/llm"
 	"github.com/gptscript-ai/gptscript/pkg/system"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 )
 
 const (
 	DefaultModel = openai.GPT4Turbo
+
+	toolImageResult = "The result is the image in the next message."
 )
 
 var (
@@ -39,6 +44,11 @@ type Client struct {
 	invalidAuth  bool
 	cacheKeyBase string
 	setSeed      bool
+	maxRetries   int
+	models       *llm.ModelList
+	// grammar is true if output schemas are sent as a grammar, for servers that do not support the json_schema
+	// response format.
+	grammar bool
 }
 
 type Options struct {
@@ -49,8 +59,12 @@ type Options struct {
 	OrgID        string         `usage:"OpenAI organization ID" name:"openai-org-id" env:"OPENAI_ORG_ID"`
 	DefaultModel string         `usage:"Default LLM model to use" default:"gpt-4-turbo"`
 	ConfigFile   string         `usage:"Path to GPTScript config file" name:"config"`
+	MaxRetries   *int           `usage:"Maximum number of times to retry a failed LLM request (default 5)" name:"max-retries"`
+	Grammar      bool           `usage:"Send output schemas as a grammar, for servers like llama.cpp without the json_schema response format" name:"openai-grammar" env:"OPENAI_GRAMMAR"`
 	SetSeed      bool           `usage:"-"`
 	CacheKey     string         `usage:"-"`
+	Deployment   string         `usage:"-"`
+	ModelsTTL    time.Duration  `usage:"-"`
 	Cache        *cache.Client
 }
 
@@ -65,6 +79,14 @@ func complete(opts ...Options) (result Options, err error) {
 		result.DefaultModel = types.FirstSet(opt.DefaultModel, result.DefaultModel)
 		result.SetSeed = types.FirstSet(opt.SetSeed, result.SetSeed)
 		result.CacheKey = types.FirstSet(opt.CacheKey, result.CacheKey)
+		result.MaxRetries = types.FirstSet(opt.MaxRetries, result.MaxRetries)
+		result.Deployment = types.FirstSet(opt.Deployment, result.Deployment)
+		result.ModelsTTL = types.FirstSet(opt.ModelsTTL, result.ModelsTTL)
+		result.Grammar = types.FirstSet(opt.Grammar, result.Grammar)
+	}
+
+	if result.MaxRetries == nil {
+		result.MaxRetries = ptr(DefaultMaxRetries)
 	}
 
 	if result.Cache == nil {
@@ -104,15 +126,22 @@ func NewClient(opts ...Options) (*Client, error) {
 	}
 
 	cfg := openai.DefaultConfig(opt.APIKey)
+	defaultBaseURL := cfg.BaseURL
 	if strings.Contains(string(opt.APIType), "AZURE") {
-		cfg = openai.DefaultAzureConfig(key, url)
-		cfg.AzureModelMapperFunc = GetAzureMapperFunction(opt.DefaultModel, azureModel)
+		cfg = openai.DefaultAzureConfig(opt.APIKey, opt.BaseURL)
+		cfg.AzureModelMapperFunc = GetAzureMapperFunction(opt.DefaultModel, types.FirstSet(opt.Deployment, azureModel))
 	}
 
 	cfg.BaseURL = types.FirstSet(opt.BaseURL, cfg.BaseURL)
 	cfg.OrgID = types.FirstSet(opt.OrgID, cfg.OrgID)
 	cfg.APIVersion = types.FirstSet(opt.APIVersion, cfg.APIVersion)
 	cfg.APIType = types.FirstSet(opt.APIType, cfg.APIType)
+	cfg.HTTPClient = &http.Client{
+		Transport: &recordingTransport{
+			next:         http.DefaultTransport,
+			includeUsage: cfg.BaseURL == defaultBaseURL && cfg.APIType == openai.APITypeOpenAI,
+		},
+	}
 
 	cacheKeyBase := opt.CacheKey
 	if cacheKeyBase == "" {
@@ -126,6 +155,9 @@ func NewClient(opts ...Options) (*Client, error) {
 		cacheKeyBase: cacheKeyBase,
 		invalidAuth:  opt.APIKey == "" && opt.BaseURL == "",
 		setSeed:      opt.SetSeed,
+		maxRetries:   *opt.MaxRetries,
+		models:       llm.NewModelList(opt.ModelsTTL),
+		grammar:      opt.Grammar,
 	}, nil
 }
 
@@ -154,6 +186,15 @@ func (c *Client) ListModels(ctx context.Context, providers ...string) (result []
 		return nil, err
 	}
 
+	return c.models.Get(ctx, c.listModels)
+}
+
+// InvalidateModels drops the cached models of the client.
+func (c *Client) InvalidateModels() {
+	c.models.Invalidate()
+}
+
+func (c *Client) listModels(ctx context.Context) (result []string, _ error) {
 	models, err := c.c.ListModels(ctx)
 	if err != nil {
 		return nil, err
@@ -165,11 +206,42 @@ func (c *Client) ListModels(ctx context.Context, providers ...string) (result []
 	return result, nil
 }
 
-func (c *Client) cacheKey(request openai.ChatCompletionRequest) string {
-	return hash.Encode(map[string]any{
+func (c *Client) cacheKey(request openai.ChatCompletionRequest, extraFields map[string]any) string {
+	key := map[string]any{
 		"base":    c.cacheKeyBase,
 		"request": request,
-	})
+	}
+	if len(extraFields) > 0 {
+		key["extra"] = extraFields
+	}
+	return hash.Encode(key)
+}
+
+// extraFields returns the fields of the request that the chat completion client can not send: the output
+// schema as a json_schema response format, or as a grammar if the client is configured for one.
+func (c *Client) extraFields(messageRequest types.CompletionRequest) map[string]any {
+	if messageRequest.OutputSchema != nil && !c.grammar {
+		return map[string]any{
+			"response_format": map[string]any{
+				"type": "json_schema",
+				"json_schema": map[string]any{
+					"name":   "output",
+					"schema": messageRequest.OutputSchema,
+				},
+			},
+		}
+	}
+
+	grammar := messageRequest.Grammar
+	if grammar == "" && messageRequest.OutputSchema != nil {
+		grammar = schemaToGrammar(messageRequest.OutputSchema)
+	}
+	if grammar == "" || !c.grammar {
+		return nil
+	}
+	return map[string]any{
+		"grammar": grammar,
+	}
 }
 
 func (c *Client) seed(request openai.ChatCompletionRequest) int {
@@ -191,7 +263,7 @@ func (c *Client) seed(request openai.ChatCompletionRequest) int {
 	return hash.Seed(newRequest)
 }
 
-func (c *Client) fromCache(ctx context.Context, messageRequest types.CompletionRequest, request openai.ChatCompletionRequest) (result []openai.ChatCompletionStreamResponse, _ bool, _ error) {
+func (c *Client) fromCache(ctx context.Context, messageRequest types.CompletionRequest, request openai.ChatCompletionRequest, extraFields map[string]any) (result []openai.ChatCompletionStreamResponse, _ bool, _ error) {
 	if cache.IsNoCache(ctx) {
 		return nil, false, nil
 	}
@@ -199,7 +271,7 @@ func (c *Client) fromCache(ctx context.Context, messageRequest types.CompletionR
 		return nil, false, nil
 	}
 
-	cache, found, err := c.cache.Get(c.cacheKey(request))
+	cache, found, err := c.cache.Get(c.cacheKey(request, extraFields))
 	if err != nil {
 		return nil, false, err
 	} else if !found {
@@ -249,7 +321,23 @@ func toMessages(request types.CompletionRequest) (result []openai.ChatCompletion
 		})
 	}
 
+	// Tool results can only be text, so their images are sent in a user message after the tool results
+	var toolImages []openai.ChatMessagePart
+	flushToolImages := func() {
+		if len(toolImages) > 0 {
+			result = append(result, openai.ChatCompletionMessage{
+				Role:         string(types.CompletionMessageRoleTypeUser),
+				MultiContent: toolImages,
+			})
+			toolImages = nil
+		}
+	}
+
 	for _, message := range msgs {
+		if message.Role != types.CompletionMessageRoleTypeTool {
+			flushToolImages()
+		}
+
 		chatMessage := openai.ChatCompletionMessage{
 			Role: string(message.Role),
 		}
@@ -270,6 +358,27 @@ func toMessages(request types.CompletionRequest) (result []openai.ChatCompletion
 					Text: content.Text,
 				})
 			}
+			if content.Image != nil {
+				part := openai.ChatMessagePart{
+					Type: openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{
+						URL:    content.Image.URL,
+						Detail: openai.ImageURLDetail(content.Image.Detail),
+					},
+				}
+				if message.Role == types.CompletionMessageRoleTypeTool {
+					toolImages = append(toolImages, part)
+				} else {
+					chatMessage.MultiContent = append(chatMessage.MultiContent, part)
+				}
+			}
+		}
+
+		if message.Role == types.CompletionMessageRoleTypeTool && len(chatMessage.MultiContent) == 0 && len(toolImages) > 0 {
+			chatMessage.MultiContent = append(chatMessage.MultiContent, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeText,
+				Text: toolImageResult,
+			})
 		}
 
 		if len(chatMessage.MultiContent) == 1 && chatMessage.MultiContent[0].Type == openai.ChatMessagePartTypeText {
@@ -287,6 +396,7 @@ func toMessages(request types.CompletionRequest) (result []openai.ChatCompletion
 		result = append(result, chatMessage)
 	}
 
+	flushToolImages()
 	return
 }
 
@@ -319,7 +429,8 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		request.Temperature = messageRequest.Temperature
 	}
 
-	if messageRequest.JSONResponse {
+	extraFields := c.extraFields(messageRequest)
+	if messageRequest.JSONResponse && extraFields["response_format"] == nil {
 		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
 			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
 		}
@@ -338,24 +449,33 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		})
 	}
 
+	if messageRequest.DisableToolCalls && len(request.Tools) > 0 {
+		request.ToolChoice = "none"
+	}
+
 	id := fmt.Sprint(atomic.AddInt64(&completionID, 1))
 	status <- types.CompletionStatus{
 		CompletionID: id,
 		Request:      request,
 	}
 
-	var cacheResponse bool
+	var (
+		cacheResponse bool
+		usage         types.Usage
+	)
 	if c.setSeed {
 		request.Seed = ptr(c.seed(request))
 	}
-	response, ok, err := c.fromCache(ctx, messageRequest, request)
+	response, ok, err := c.fromCache(ctx, messageRequest, request, extraFields)
 	if err != nil {
 		return nil, err
 	} else if !ok {
-		response, err = c.call(ctx, request, id, status)
+		callCtx, recorder := withResponseRecorder(ctx, extraFields)
+		response, err = c.call(callCtx, request, id, status)
 		if err != nil {
 			return nil, err
 		}
+		usage = recorder.getUsage()
 	} else {
 		cacheResponse = true
 	}
@@ -376,6 +496,7 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		CompletionID: id,
 		Chunks:       response,
 		Response:     result,
+		Usage:        usage,
 		Cached:       cacheResponse,
 	}
 
@@ -462,8 +583,48 @@ func (c *Client) store(ctx context.Context, key string, responses []openai.ChatC
 	return c.cache.Store(key, buf.Bytes())
 }
 
-func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest, transactionID string, partial chan<- types.CompletionStatus) (responses []openai.ChatCompletionStreamResponse, _ error) {
-	cacheKey := c.cacheKey(request)
+// call sends the request, retrying transient failures with backoff. A stream that fails part way through is
+// restarted from the beginning.
+func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest, transactionID string, partial chan<- types.CompletionStatus) ([]openai.ChatCompletionStreamResponse, error) {
+	recorder := getResponseRecorder(ctx)
+
+	for attempt := 1; ; attempt++ {
+		responses, err := c.callOnce(ctx, request, transactionID, partial)
+		if err == nil || attempt > c.maxRetries || !isRetryable(err) {
+			return responses, modelUnavailable(err)
+		}
+
+		var retryAfter time.Duration
+		if recorder != nil {
+			retryAfter = recorder.takeRetryAfter()
+		}
+		delay := retryDelay(attempt, retryAfter)
+
+		log.Debugf("retrying completion %s in %s after error: %v", transactionID, delay, err)
+		partial <- types.CompletionStatus{
+			CompletionID: transactionID,
+			Retry: &types.CompletionRetry{
+				Attempt:    attempt,
+				MaxRetries: c.maxRetries,
+				Delay:      delay,
+				Error:      err.Error(),
+			},
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) callOnce(ctx context.Context, request openai.ChatCompletionRequest, transactionID string, partial chan<- types.CompletionStatus) (responses []openai.ChatCompletionStreamResponse, _ error) {
+	var extraFields map[string]any
+	if recorder := getResponseRecorder(ctx); recorder != nil {
+		extraFields = recorder.extraFields
+	}
+	cacheKey := c.cacheKey(request, extraFields)
 	request.Stream = os.Getenv("GPTSCRIPT_INTERNAL_OPENAI_STREAMING") != "false"
 
 	partial <- types.CompletionStatus{
@@ -481,6 +642,11 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 		if err != nil {
 			return nil, err
 		}
+		recordUsage(ctx, types.Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		})
 		return []openai.ChatCompletionStreamResponse{
 			{
 				ID:      resp.ID,
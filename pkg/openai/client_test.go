@@ -0,0 +1,55 @@
+package openai
+
+import (
+	"testing"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToMessagesImages(t *testing.T) {
+	image := &types.ImageURL{URL: "data:image/png;base64,AAAA"}
+	msgs, err := toMessages(types.CompletionRequest{
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{
+				Role:    types.CompletionMessageRoleTypeUser,
+				Content: []types.ContentPart{{Text: "What is this?"}, {Image: image}},
+			},
+			{
+				Role: types.CompletionMessageRoleTypeAssistant,
+				Content: []types.ContentPart{
+					{ToolCall: &types.CompletionToolCall{ID: "call_1", Function: types.CompletionFunctionCall{Name: "read"}}},
+					{ToolCall: &types.CompletionToolCall{ID: "call_2", Function: types.CompletionFunctionCall{Name: "read"}}},
+				},
+			},
+			{
+				Role:     types.CompletionMessageRoleTypeTool,
+				Content:  []types.ContentPart{{Image: image}},
+				ToolCall: &types.CompletionToolCall{ID: "call_1"},
+			},
+			{
+				Role:     types.CompletionMessageRoleTypeTool,
+				Content:  types.Text("done"),
+				ToolCall: &types.CompletionToolCall{ID: "call_2"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, msgs, 5)
+
+	require.Len(t, msgs[0].MultiContent, 2)
+	assert.Equal(t, openai.ChatMessagePartTypeImageURL, msgs[0].MultiContent[1].Type)
+	assert.Equal(t, image.URL, msgs[0].MultiContent[1].ImageURL.URL)
+
+	// The image of the tool result is sent in a user message after all tool results
+	assert.Equal(t, "tool", msgs[2].Role)
+	assert.Equal(t, toolImageResult, msgs[2].Content)
+	assert.Equal(t, "tool", msgs[3].Role)
+	assert.Equal(t, "done", msgs[3].Content)
+	assert.Equal(t, "user", msgs[4].Role)
+	require.Len(t, msgs[4].MultiContent, 1)
+	assert.Equal(t, image.URL, msgs[4].MultiContent[0].ImageURL.URL)
+}
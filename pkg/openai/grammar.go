@@ -0,0 +1,144 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// jsonGrammar are the GBNF rules for any JSON value, shared by every generated grammar.
+const jsonGrammar = `ws ::= [ \t\n]*
+value ::= object | array | string | number | boolean | null
+object ::= "{" ws ( string ws ":" ws value ws ( "," ws string ws ":" ws value ws )* )? "}"
+array ::= "[" ws ( value ws ( "," ws value ws )* )? "]"
+string ::= "\"" ( [^"\\\x7F\x00-\x1F] | "\\" ( ["\\/bfnrt] | "u" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] ) )* "\""
+number ::= integer ( "." [0-9]+ )? ( [eE] [-+]? [0-9]+ )?
+integer ::= "-"? ( "0" | [1-9] [0-9]* )
+boolean ::= "true" | "false"
+null ::= "null"
+`
+
+// schemaToGrammar converts a JSON schema to a GBNF grammar, as accepted by llama.cpp and compatible servers, for
+// servers that do not support a json_schema response format. Parts of the schema the grammar can not express
+// fall back to any JSON value, the result is still validated against the schema after the completion.
+func schemaToGrammar(schema *openapi3.Schema) string {
+	g := &grammar{}
+	root := g.rule(schema)
+
+	buf := &strings.Builder{}
+	_, _ = fmt.Fprintf(buf, "root ::= ws %s ws\n", root)
+	for _, rule := range g.rules {
+		buf.WriteString(rule)
+		buf.WriteString("\n")
+	}
+	buf.WriteString(jsonGrammar)
+	return buf.String()
+}
+
+type grammar struct {
+	rules []string
+}
+
+func (g *grammar) add(expr string) string {
+	name := fmt.Sprintf("r%d", len(g.rules))
+	g.rules = append(g.rules, name+" ::= "+expr)
+	return name
+}
+
+func (g *grammar) rule(schema *openapi3.Schema) string {
+	if schema == nil {
+		return "value"
+	}
+
+	if len(schema.Enum) > 0 {
+		var alternatives []string
+		for _, v := range schema.Enum {
+			alternatives = append(alternatives, literal(v))
+		}
+		return g.add(strings.Join(alternatives, " | "))
+	}
+
+	if len(schema.AnyOf) > 0 || len(schema.OneOf) > 0 {
+		var alternatives []string
+		for _, ref := range slices.Concat(schema.AnyOf, schema.OneOf) {
+			alternatives = append(alternatives, g.rule(ref.Value))
+		}
+		return g.add(strings.Join(alternatives, " | "))
+	}
+
+	switch schema.Type {
+	case openapi3.TypeString:
+		return "string"
+	case openapi3.TypeNumber:
+		return "number"
+	case openapi3.TypeInteger:
+		return "integer"
+	case openapi3.TypeBoolean:
+		return "boolean"
+	case openapi3.TypeArray:
+		if schema.Items == nil {
+			return "array"
+		}
+		item := g.rule(schema.Items.Value)
+		return g.add(fmt.Sprintf(`"[" ws ( %[1]s ws ( "," ws %[1]s ws )* )? "]"`, item))
+	case openapi3.TypeObject:
+		return g.object(schema)
+	}
+
+	return "value"
+}
+
+// object lists the required properties first, in the order of the schema. Optional properties are only
+// allowed after a required one, as they would otherwise need a rule for every combination of leading comma.
+func (g *grammar) object(schema *openapi3.Schema) string {
+	var required []string
+	for _, name := range schema.Required {
+		if _, ok := schema.Properties[name]; ok {
+			required = append(required, name)
+		}
+	}
+	if len(required) == 0 {
+		return "object"
+	}
+
+	var optional []string
+	for name := range schema.Properties {
+		if !slices.Contains(required, name) {
+			optional = append(optional, name)
+		}
+	}
+	slices.Sort(optional)
+
+	property := func(name string) string {
+		return fmt.Sprintf(`%s ws ":" ws %s ws`, literal(name), g.rule(schema.Properties[name].Value))
+	}
+
+	var parts []string
+	for i, name := range required {
+		if i > 0 {
+			parts = append(parts, `"," ws`)
+		}
+		parts = append(parts, property(name))
+	}
+	for _, name := range optional {
+		parts = append(parts, fmt.Sprintf(`( "," ws %s )?`, property(name)))
+	}
+
+	return g.add(`"{" ws ` + strings.Join(parts, " ") + ` "}"`)
+}
+
+// literal returns a GBNF string literal matching v encoded as JSON.
+func literal(v any) string {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "value"
+	}
+	data := strings.TrimSpace(buf.String())
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(data) + `"`
+}
@@ -0,0 +1,79 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaToGrammar(t *testing.T) {
+	var schema openapi3.Schema
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"color": {"enum": ["red", "blue"]},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"age": {"type": "integer"}
+		},
+		"required": ["name", "color"]
+	}`), &schema))
+
+	autogold.Expect(`root ::= ws r2 ws
+r0 ::= "\"red\"" | "\"blue\""
+r1 ::= "[" ws ( string ws ( "," ws string ws )* )? "]"
+r2 ::= "{" ws "\"name\"" ws ":" ws string ws "," ws "\"color\"" ws ":" ws r0 ws ( "," ws "\"age\"" ws ":" ws integer ws )? ( "," ws "\"tags\"" ws ":" ws r1 ws )? "}"
+`+jsonGrammar).Equal(t, schemaToGrammar(&schema))
+}
+
+func TestCallOutputSchemaGrammar(t *testing.T) {
+	var body map[string]any
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"\\\"hi\\\"\"}}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer s.Close()
+
+	status := make(chan types.CompletionStatus)
+	go func() {
+		for range status {
+		}
+	}()
+	defer close(status)
+
+	call := func(opts Options) {
+		c, err := NewClient(Options{
+			BaseURL: s.URL,
+			APIKey:  "test",
+		}, opts)
+		require.NoError(t, err)
+
+		_, err = c.Call(context.Background(), types.CompletionRequest{
+			Model:        "test-model",
+			Messages:     []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hi")}},
+			OutputSchema: openapi3.NewStringSchema(),
+		}, status)
+		require.NoError(t, err)
+	}
+
+	// Compatible servers get the json_schema response format unless a grammar is asked for
+	call(Options{})
+	assert.Nil(t, body["grammar"])
+	assert.Equal(t, "json_schema", body["response_format"].(map[string]any)["type"])
+
+	call(Options{Grammar: true})
+	assert.Nil(t, body["response_format"])
+	assert.Contains(t, body["grammar"], "root ::= ws string ws")
+}
@@ -0,0 +1,115 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/llm"
+)
+
+const (
+	DefaultMaxRetries = 5
+
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute
+	// maxRetryAfter caps how long a Retry-After header can make us wait.
+	maxRetryAfter = 5 * time.Minute
+)
+
+// isRetryable returns true for errors that are likely to go away if the same request is sent again, such as
+// rate limits, overloaded or unavailable servers and connections that were dropped while streaming.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Type == "insufficient_quota" || apiErr.Code == "insufficient_quota" {
+			return false
+		}
+		return isRetryableStatus(apiErr.HTTPStatusCode)
+	}
+
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return isRetryableStatus(reqErr.HTTPStatusCode)
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// modelUnavailable wraps the errors another model may not have as an llm.ErrModelUnavailable, so that the registry
+// falls back to the next model: errors that remained after retrying, a model that is not found and a request that
+// does not fit in the context of the model.
+func modelUnavailable(err error) error {
+	if err == nil || !isRetryable(err) && !isModelError(err) {
+		return err
+	}
+	return &llm.ErrModelUnavailable{
+		Err: err,
+	}
+}
+
+func isModelError(err error) bool {
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.HTTPStatusCode == http.StatusNotFound || apiErr.Code == "model_not_found" || apiErr.Code == "context_length_exceeded"
+}
+
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+		// Used by some providers to signal that they are overloaded
+		529:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns the time to wait before the given retry attempt, starting at 1. The server's Retry-After
+// is used if it sent one, otherwise the delay grows exponentially with full jitter.
+func retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, maxRetryAfter)
+	}
+
+	backoff := retryBaseDelay << min(attempt-1, 10)
+	backoff = min(backoff, retryMaxDelay)
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+func parseRetryAfter(header http.Header) time.Duration {
+	// Not standard, but sent by OpenAI with a better resolution than Retry-After
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
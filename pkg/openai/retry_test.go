@@ -0,0 +1,137 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/llm"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallRetries(t *testing.T) {
+	var requests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.Header().Set("Retry-After-Ms", "10")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":{"message":"Rate limit reached","type":"requests"}}`))
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`bad gateway`))
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"hello\"}}]}\n\n")
+			_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+		}
+	}))
+	defer s.Close()
+
+	c, err := NewClient(Options{
+		BaseURL: s.URL,
+		APIKey:  "test",
+	})
+	require.NoError(t, err)
+
+	var (
+		status  = make(chan types.CompletionStatus)
+		retries []types.CompletionRetry
+		done    = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for s := range status {
+			if s.Retry != nil {
+				retries = append(retries, *s.Retry)
+			}
+		}
+	}()
+
+	resp, err := c.Call(context.Background(), types.CompletionRequest{
+		Model:    "test-model",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hi")}},
+	}, status)
+	close(status)
+	<-done
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello", resp.String())
+	assert.Equal(t, 3, requests)
+	require.Len(t, retries, 2)
+	assert.Equal(t, 1, retries[0].Attempt)
+	assert.Equal(t, DefaultMaxRetries, retries[0].MaxRetries)
+	assert.Equal(t, 10*time.Millisecond, retries[0].Delay)
+	assert.Contains(t, retries[0].Error, "Rate limit reached")
+	assert.Equal(t, 2, retries[1].Attempt)
+}
+
+func TestCallDoesNotRetryClientErrors(t *testing.T) {
+	var requests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"Invalid request","type":"invalid_request_error"}}`))
+	}))
+	defer s.Close()
+
+	c, err := NewClient(Options{
+		BaseURL: s.URL,
+		APIKey:  "test",
+	})
+	require.NoError(t, err)
+
+	status := make(chan types.CompletionStatus, 10)
+	_, err = c.Call(context.Background(), types.CompletionRequest{
+		Model:    "test-model",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hi")}},
+	}, status)
+	require.ErrorContains(t, err, "Invalid request")
+	assert.Equal(t, 1, requests)
+	// Another model would get the same error, so it is not one to fall back on
+	unavailable := (*llm.ErrModelUnavailable)(nil)
+	assert.False(t, errors.As(err, &unavailable))
+}
+
+func TestModelUnavailable(t *testing.T) {
+	unavailable := (*llm.ErrModelUnavailable)(nil)
+	for _, err := range []error{
+		&openai.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "Rate limit reached"},
+		&openai.APIError{HTTPStatusCode: http.StatusNotFound, Code: "model_not_found"},
+		&openai.APIError{HTTPStatusCode: http.StatusBadRequest, Code: "context_length_exceeded"},
+		&openai.RequestError{HTTPStatusCode: http.StatusServiceUnavailable, Err: errors.New("unavailable")},
+	} {
+		assert.True(t, errors.As(modelUnavailable(err), &unavailable), err.Error())
+	}
+	for _, err := range []error{
+		&openai.APIError{HTTPStatusCode: http.StatusUnauthorized, Message: "Invalid API key"},
+		&openai.APIError{HTTPStatusCode: http.StatusTooManyRequests, Code: "insufficient_quota"},
+		context.Canceled,
+	} {
+		assert.False(t, errors.As(modelUnavailable(err), &unavailable), err.Error())
+	}
+	assert.Nil(t, modelUnavailable(nil))
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, 3*time.Second, retryDelay(1, 3*time.Second))
+	assert.Equal(t, maxRetryAfter, retryDelay(1, time.Hour))
+
+	for attempt := 1; attempt < 20; attempt++ {
+		backoff := min(retryBaseDelay<<min(attempt-1, 10), retryMaxDelay)
+		delay := retryDelay(attempt, 0)
+		assert.GreaterOrEqual(t, delay, backoff/2)
+		assert.LessOrEqual(t, delay, backoff)
+	}
+
+	assert.Equal(t, 2*time.Second, parseRetryAfter(http.Header{"Retry-After": []string{"2"}}))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(http.Header{}))
+}
@@ -0,0 +1,185 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+type recorderKey struct{}
+
+// responseRecorder collects what the chat completion client does not expose from the HTTP responses of a
+// single completion request: the token usage and the Retry-After header of a failed request. It also holds
+// the request fields the client has no support for, such as a json_schema response format or a grammar.
+type responseRecorder struct {
+	lock        sync.Mutex
+	usage       types.Usage
+	retryAfter  time.Duration
+	extraFields map[string]any
+}
+
+func (u *responseRecorder) setUsage(usage types.Usage) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.usage = usage
+}
+
+func (u *responseRecorder) getUsage() types.Usage {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return u.usage
+}
+
+func (u *responseRecorder) setRetryAfter(retryAfter time.Duration) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.retryAfter = retryAfter
+}
+
+// takeRetryAfter returns the last recorded Retry-After and resets it for the next attempt.
+func (u *responseRecorder) takeRetryAfter() time.Duration {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	retryAfter := u.retryAfter
+	u.retryAfter = 0
+	return retryAfter
+}
+
+func withResponseRecorder(ctx context.Context, extraFields map[string]any) (context.Context, *responseRecorder) {
+	recorder := &responseRecorder{
+		extraFields: extraFields,
+	}
+	return context.WithValue(ctx, recorderKey{}, recorder), recorder
+}
+
+func getResponseRecorder(ctx context.Context) *responseRecorder {
+	recorder, _ := ctx.Value(recorderKey{}).(*responseRecorder)
+	return recorder
+}
+
+func recordUsage(ctx context.Context, usage types.Usage) {
+	if recorder := getResponseRecorder(ctx); recorder != nil {
+		recorder.setUsage(usage)
+	}
+}
+
+type apiUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+func (a apiUsage) toUsage() types.Usage {
+	return types.Usage{
+		PromptTokens:     a.PromptTokens,
+		CompletionTokens: a.CompletionTokens,
+		CachedTokens:     a.PromptTokensDetails.CachedTokens,
+		TotalTokens:      a.TotalTokens,
+	}
+}
+
+// recordingTransport captures the usage chunk of streamed completions and the Retry-After header of failed
+// requests, and adds the extra fields of the recorder to the request. The chat completion client does not
+// expose stream_options, the usage field of stream chunks or response headers of errors, so this is done at
+// the HTTP level.
+type recordingTransport struct {
+	next http.RoundTripper
+	// includeUsage will request the usage chunk by setting stream_options. Not all OpenAI compatible
+	// servers accept this field, so it is only sent to the OpenAI API.
+	includeUsage bool
+}
+
+func (u *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := getResponseRecorder(req.Context())
+	if recorder == nil {
+		return u.next.RoundTrip(req)
+	}
+
+	if (u.includeUsage || len(recorder.extraFields) > 0) && req.Method == http.MethodPost && req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		body := map[string]any{}
+		if err := json.Unmarshal(data, &body); err == nil {
+			if u.includeUsage && body["stream"] == true {
+				body["stream_options"] = map[string]any{
+					"include_usage": true,
+				}
+			}
+			for k, v := range recorder.extraFields {
+				body[k] = v
+			}
+			if newData, err := json.Marshal(body); err == nil {
+				data = newData
+			}
+		}
+
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+	}
+
+	resp, err := u.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	} else if resp.StatusCode > 299 {
+		recorder.setRetryAfter(parseRetryAfter(resp.Header))
+		return resp, nil
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body = &usageReader{
+			ReadCloser: resp.Body,
+			recorder:   recorder,
+		}
+	}
+
+	return resp, nil
+}
+
+// usageReader passes the stream through untouched while looking for a chunk with usage in it.
+type usageReader struct {
+	io.ReadCloser
+	recorder *responseRecorder
+	line     []byte
+}
+
+func (u *usageReader) Read(p []byte) (int, error) {
+	n, err := u.ReadCloser.Read(p)
+	for _, b := range p[:n] {
+		if b != '\n' {
+			u.line = append(u.line, b)
+			continue
+		}
+		u.scan(u.line)
+		u.line = u.line[:0]
+	}
+	return n, err
+}
+
+func (u *usageReader) scan(line []byte) {
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok || !bytes.Contains(data, []byte(`"usage"`)) {
+		return
+	}
+
+	var chunk struct {
+		Usage *apiUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(data), &chunk); err == nil && chunk.Usage != nil {
+		u.recorder.setUsage(chunk.Usage.toUsage())
+	}
+}
@@ -0,0 +1,122 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamWithUsage is a streamed completion recorded from the OpenAI API with stream_options.include_usage set,
+// which sends the usage in a last chunk without choices.
+const streamWithUsage = `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1727000000,"model":"gpt-4o-2024-08-06","choices":[{"index":0,"delta":{"role":"assistant","content":"","refusal":null},"logprobs":null,"finish_reason":null}],"usage":null}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1727000000,"model":"gpt-4o-2024-08-06","choices":[{"index":0,"delta":{"content":"Hello"},"logprobs":null,"finish_reason":null}],"usage":null}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1727000000,"model":"gpt-4o-2024-08-06","choices":[{"index":0,"delta":{},"logprobs":null,"finish_reason":"stop"}],"usage":null}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1727000000,"model":"gpt-4o-2024-08-06","choices":[],"usage":{"prompt_tokens":1200,"completion_tokens":3,"total_tokens":1203,"prompt_tokens_details":{"cached_tokens":1024}}}
+
+data: [DONE]
+
+`
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRecordingTransportUsage(t *testing.T) {
+	for _, includeUsage := range []bool{true, false} {
+		var body map[string]any
+		transport := &recordingTransport{
+			includeUsage: includeUsage,
+			next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+					// Reading a byte at a time splits the lines of the stream across reads
+					Body: io.NopCloser(iotest.OneByteReader(strings.NewReader(streamWithUsage))),
+				}, nil
+			}),
+		}
+
+		ctx, recorder := withResponseRecorder(context.Background(), nil)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/chat/completions",
+			bytes.NewReader([]byte(`{"model":"gpt-4o","stream":true}`)))
+		require.NoError(t, err)
+
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		// The stream is passed through untouched
+		assert.Equal(t, streamWithUsage, string(data))
+		assert.Equal(t, types.Usage{
+			PromptTokens:     1200,
+			CompletionTokens: 3,
+			CachedTokens:     1024,
+			TotalTokens:      1203,
+		}, recorder.getUsage())
+
+		if includeUsage {
+			assert.Equal(t, map[string]any{"include_usage": true}, body["stream_options"])
+		} else {
+			assert.Nil(t, body["stream_options"])
+		}
+	}
+}
+
+func TestCallUsage(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, streamWithUsage)
+	}))
+	defer s.Close()
+
+	c, err := NewClient(Options{
+		BaseURL: s.URL,
+		APIKey:  "test",
+	})
+	require.NoError(t, err)
+
+	var usage []types.Usage
+	status := make(chan types.CompletionStatus)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for s := range status {
+			if !s.Usage.IsZero() {
+				usage = append(usage, s.Usage)
+			}
+		}
+	}()
+
+	result, err := c.Call(context.Background(), types.CompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hi")}},
+	}, status)
+	close(status)
+	<-done
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello", result.String())
+	assert.Equal(t, []types.Usage{{
+		PromptTokens:     1200,
+		CompletionTokens: 3,
+		CachedTokens:     1024,
+		TotalTokens:      1203,
+	}}, usage)
+}
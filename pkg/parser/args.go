@@ -0,0 +1,233 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var argTypes = map[string]bool{
+	"string":  true,
+	"integer": true,
+	"number":  true,
+	"boolean": true,
+	"object":  true,
+	"array":   true,
+}
+
+// parseArgModifiers sets the type, default and enum values of an argument from modifiers like
+// "integer, required, default=3", "enum=red|green|blue" or "array of integer". It returns if the argument is
+// required.
+func parseArgModifiers(schema *openapi3.Schema, modifiers string) (required bool, _ error) {
+	var defaultValue, enum *string
+	for _, modifier := range splitModifiers(modifiers) {
+		key, value, hasValue := strings.Cut(modifier, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch {
+		case hasValue && key == "default":
+			defaultValue = &value
+		case hasValue && key == "enum":
+			enum = &value
+		case !hasValue && key == "required":
+			required = true
+		case !hasValue && strings.HasPrefix(key, "array of "):
+			itemType := strings.TrimSpace(strings.TrimPrefix(key, "array of "))
+			if !argTypes[itemType] || itemType == "array" {
+				return false, fmt.Errorf("invalid array item type %q", itemType)
+			}
+			schema.Type = "array"
+			schema.Items = &openapi3.SchemaRef{
+				Value: &openapi3.Schema{
+					Type: itemType,
+				},
+			}
+		case !hasValue && argTypes[key]:
+			schema.Type = key
+			if key == "array" {
+				schema.Items = &openapi3.SchemaRef{
+					Value: &openapi3.Schema{
+						Type: "string",
+					},
+				}
+			}
+		default:
+			return false, fmt.Errorf("unknown modifier %q", modifier)
+		}
+	}
+
+	if enum != nil {
+		for _, value := range splitValues(*enum, '|') {
+			v, err := argValue(schema.Type, strings.TrimSpace(value))
+			if err != nil {
+				return false, fmt.Errorf("invalid enum value: %w", err)
+			}
+			schema.Enum = append(schema.Enum, v)
+		}
+	}
+
+	if defaultValue != nil {
+		v, err := argValue(schema.Type, *defaultValue)
+		if err != nil {
+			return false, fmt.Errorf("invalid default: %w", err)
+		}
+		schema.Default = v
+	}
+
+	return required, nil
+}
+
+// argValue converts a default or enum value to the type of the argument. A string value may be quoted as a JSON
+// string to hold commas, pipes or parentheses.
+func argValue(argType, value string) (any, error) {
+	switch argType {
+	case "integer":
+		return strconv.Atoi(value)
+	case "number":
+		return strconv.ParseFloat(value, 64)
+	case "boolean":
+		return toBool(value)
+	case "object", "array":
+		var v any
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return nil, fmt.Errorf("%q is not JSON", value)
+		}
+		return v, nil
+	default:
+		if !strings.HasPrefix(value, `"`) {
+			return value, nil
+		}
+		var v string
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return nil, fmt.Errorf("%s is not a quoted string", value)
+		}
+		return v, nil
+	}
+}
+
+// cutModifiers cuts the modifiers of an argument at the closing parenthesis, ignoring the parentheses and
+// commas of quoted or JSON values.
+func cutModifiers(s string) (modifiers, rest string, found bool) {
+	var (
+		depth  int
+		quoted bool
+	)
+	for i, c := range s {
+		switch {
+		case quoted:
+			if c == '"' && !strings.HasSuffix(s[:i], `\`) {
+				quoted = false
+			}
+		case c == '"':
+			quoted = true
+		case c == '[' || c == '{' || c == '(':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ')':
+			if depth == 0 {
+				return s[:i], s[i+1:], true
+			}
+			depth--
+		}
+	}
+	return s, "", false
+}
+
+// splitModifiers splits modifiers on the commas that are not part of a JSON value.
+func splitModifiers(s string) []string {
+	return splitValues(s, ',')
+}
+
+// splitValues splits s on the separators that are not part of a JSON value.
+func splitValues(s string, sep rune) (result []string) {
+	var (
+		depth  int
+		quoted bool
+		start  int
+	)
+	for i, c := range s {
+		switch {
+		case quoted:
+			if c == '"' && !strings.HasSuffix(s[:i], `\`) {
+				quoted = false
+			}
+		case c == '"':
+			quoted = true
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			result = append(result, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(result, strings.TrimSpace(s[start:]))
+}
+
+var (
+	argsFields = map[string]bool{"type": true, "properties": true, "required": true}
+	argFields  = map[string]bool{"type": true, "description": true, "default": true, "enum": true, "items": true}
+)
+
+// checkArgLines returns an error if the arguments of a tool can not be written as "Args:" lines without losing
+// part of their schema.
+func checkArgLines(args *openapi3.Schema) error {
+	if args == nil {
+		return nil
+	}
+	if args.Type != "object" && args.Type != "" {
+		return fmt.Errorf("the type of the arguments is %q, not object", args.Type)
+	}
+	if err := checkFields(args, argsFields); err != nil {
+		return err
+	}
+
+	for name, prop := range args.Properties {
+		if prop.Value == nil || strings.ContainsAny(name, ":(") || strings.TrimSpace(name) != name {
+			return fmt.Errorf("arg %q can not be written", name)
+		}
+		schema := prop.Value
+		if err := checkFields(schema, argFields); err != nil {
+			return fmt.Errorf("arg %s: %w", name, err)
+		}
+		if !argTypes[schema.Type] && schema.Type != "" {
+			return fmt.Errorf("arg %s: type %q can not be written", name, schema.Type)
+		}
+		if strings.Contains(schema.Description, "\n") {
+			return fmt.Errorf("arg %s: the description has more than one line", name)
+		}
+		if schema.Items != nil {
+			items := schema.Items.Value
+			if schema.Type != "array" || items == nil || !argTypes[items.Type] || items.Type == "array" {
+				return fmt.Errorf("arg %s: the items can not be written", name)
+			}
+			if err := checkFields(items, map[string]bool{"type": true}); err != nil {
+				return fmt.Errorf("arg %s items: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkFields returns an error if the JSON of a schema has fields that are not allowed.
+func checkFields(schema *openapi3.Schema, allowed map[string]bool) error {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for field := range fields {
+		if !allowed[field] {
+			return fmt.Errorf("%s can not be written", field)
+		}
+	}
+	return nil
+}
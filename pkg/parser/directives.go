@@ -0,0 +1,139 @@
+package parser
+
+// Directive describes a parameter line of a tool, like "Name: value", for editors and documentation.
+type Directive struct {
+	// Name is the preferred spelling of the directive
+	Name string
+	// Aliases are the other accepted spellings, in normalized form
+	Aliases []string
+	// Description is a short markdown description of the value
+	Description string
+	// ToolRefs is set for directives whose value is a comma-separated list of tool references
+	ToolRefs bool
+}
+
+// Directives are the directives handled by the parser, in the order they are usually written.
+var Directives = []Directive{
+	{
+		Name:        "Name",
+		Description: "The name of the tool, used to reference it from other tools.",
+	},
+	{
+		Name:        "Description",
+		Description: "The description of the tool, used by the LLM to decide when to call it.",
+	},
+	{
+		Name:        "Model",
+		Aliases:     []string{"modelname"},
+		Description: "The model the tool uses, optionally followed by `, fallback MODEL` entries tried in order when it fails.",
+	},
+	{
+		Name:        "Global Model",
+		Aliases:     []string{"globalmodelname"},
+		Description: "The default model of all the tools in the file.",
+	},
+	{
+		Name:        "Model Provider",
+		Description: "Marks the tool as a model provider.",
+	},
+	{
+		Name:        "Internal Prompt",
+		Description: "Set to `false` to disable the built-in system prompt of the tool.",
+	},
+	{
+		Name:        "Chat",
+		Description: "Set to `true` to make the tool a chat that keeps asking the user for input.",
+	},
+	{
+		Name:        "Tools",
+		Aliases:     []string{"tool"},
+		Description: "A comma-separated list of the tools the LLM may call.",
+		ToolRefs:    true,
+	},
+	{
+		Name:        "Global Tools",
+		Aliases:     []string{"globaltool"},
+		Description: "A comma-separated list of the tools every tool in the file may call.",
+		ToolRefs:    true,
+	},
+	{
+		Name:        "Export",
+		Description: "A comma-separated list of the tools made available to the tools that use this one.",
+		ToolRefs:    true,
+	},
+	{
+		Name:        "Context",
+		Description: "A comma-separated list of tools whose output is added to the system prompt.",
+		ToolRefs:    true,
+	},
+	{
+		Name:        "Export Context",
+		Description: "A comma-separated list of context tools made available to the tools that use this one.",
+		ToolRefs:    true,
+	},
+	{
+		Name:        "Credentials",
+		Aliases:     []string{"creds", "credential", "cred"},
+		Description: "A comma-separated list of credential tools to run before the tool.",
+		ToolRefs:    true,
+	},
+	{
+		Name:        "Args",
+		Aliases:     []string{"arg", "param", "params", "parameters", "parameter"},
+		Description: "An argument of the tool, as `name: description` or `name (modifiers): description`.",
+	},
+	{
+		Name:        "Max Tokens",
+		Aliases:     []string{"maxtoken"},
+		Description: "The maximum number of tokens the LLM may generate.",
+	},
+	{
+		Name:        "Max Context",
+		Description: "The number of tokens the conversation may use before older messages are trimmed.",
+	},
+	{
+		Name:        "Max Parallel Calls",
+		Description: "The maximum number of calls of this tool that run at the same time.",
+	},
+	{
+		Name:        "Max Turns",
+		Description: "The number of times the LLM may respond with tool calls before it must answer.",
+	},
+	{
+		Name:        "Timeout",
+		Description: "How long a command or LLM call of the tool may take, as a duration like `30s`.",
+	},
+	{
+		Name:        "Cache",
+		Description: "Set to `false` to disable the cache of the LLM responses of the tool.",
+	},
+	{
+		Name:        "JSON Response",
+		Aliases:     []string{"jsonmode", "json", "jsonoutput", "jsonformat"},
+		Description: "Set to `true` to make the LLM respond in JSON.",
+	},
+	{
+		Name:        "Temperature",
+		Description: "The temperature of the LLM, 0 by default.",
+	},
+	{
+		Name:        "Output Schema",
+		Description: "A JSON Schema, inline or as a path to a JSON or YAML file, the response must match.",
+	},
+}
+
+// LookupDirective returns the directive of the key of a parameter line, in any of its accepted spellings.
+func LookupDirective(key string) (Directive, bool) {
+	key = normalize(key)
+	for _, directive := range Directives {
+		if normalize(directive.Name) == key {
+			return directive, true
+		}
+		for _, alias := range directive.Aliases {
+			if alias == key {
+				return directive, true
+			}
+		}
+	}
+	return Directive{}, false
+}
@@ -0,0 +1,298 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatGPT      = "gpt"
+	FormatYAML     = "yaml"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+)
+
+// FormatOf returns the format of a file from its name: .gpt.yaml and .gpt.yml files are YAML, .gpt.json files are
+// JSON, .md and .markdown files are Markdown and any other file is the .gpt text format.
+func FormatOf(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".gpt.yaml"), strings.HasSuffix(name, ".gpt.yml"):
+		return FormatYAML
+	case strings.HasSuffix(name, ".gpt.json"):
+		return FormatJSON
+	case strings.HasSuffix(name, ".md"), strings.HasSuffix(name, ".markdown"):
+		return FormatMarkdown
+	default:
+		return FormatGPT
+	}
+}
+
+// structuredFile is a document in the YAML and JSON formats, a list of tools that map directly onto types.Tool.
+type structuredFile struct {
+	Tools []structuredTool `json:"tools"`
+}
+
+// structuredTool is a tool, or a text node if Text is set, in the YAML and JSON formats.
+type structuredTool struct {
+	types.Parameters
+	Instructions string `json:"instructions,omitempty"`
+	Text         string `json:"text,omitempty"`
+}
+
+// ParseFormat parses a document in any of the formats. The YAML and JSON formats are parsed the same, as JSON
+// is YAML.
+func ParseFormat(input io.Reader, format string, opts ...Options) (Document, error) {
+	if format == FormatGPT {
+		return Parse(input, opts...)
+	}
+
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return Document{}, err
+	}
+
+	var nodes []Node
+	if format == FormatMarkdown {
+		nodes, err = parseMarkdown(data)
+	} else {
+		nodes, err = parseStructured(data)
+	}
+	if err != nil {
+		return Document{}, err
+	}
+	return newDocument(nodes, complete(opts...))
+}
+
+func parseStructured(data []byte) (result []Node, _ error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, NewErrLine("", doc.Line, fmt.Errorf("expected an object with a list of tools"))
+	}
+
+	var tools *yaml.Node
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if key := doc.Content[i]; key.Value != "tools" {
+			return nil, NewErrLine("", key.Line, fmt.Errorf("unknown field %q", key.Value))
+		}
+		tools = doc.Content[i+1]
+	}
+	if tools == nil || tools.Tag == "!!null" {
+		return nil, nil
+	}
+	if tools.Kind != yaml.SequenceNode {
+		return nil, NewErrLine("", tools.Line, fmt.Errorf("tools must be a list"))
+	}
+
+	for _, item := range tools.Content {
+		node, err := parseStructuredTool(item)
+		if err != nil {
+			return nil, NewErrLine("", item.Line, err)
+		}
+		result = append(result, node)
+	}
+	return result, nil
+}
+
+func parseStructuredTool(item *yaml.Node) (Node, error) {
+	// The tool is decoded as JSON so the JSON schemas of the arguments are read the same as in every other place
+	var value any
+	if err := item.Decode(&value); err != nil {
+		return Node{}, err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Node{}, err
+	}
+
+	var tool structuredTool
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&tool); err != nil {
+		return Node{}, fmt.Errorf("invalid tool: %w", err)
+	}
+
+	if tool.Text != "" {
+		if tool.Instructions != "" || len(item.Content) > 2 {
+			return Node{}, fmt.Errorf("a text node can not have other fields")
+		}
+		return Node{
+			TextNode: &TextNode{
+				Text: tool.Text,
+			},
+		}, nil
+	}
+
+	result := types.Tool{
+		Parameters:   tool.Parameters,
+		Instructions: tool.Instructions,
+		Source: types.ToolSource{
+			LineNo: item.Line,
+		},
+	}
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		if item.Content[i].Value == "instructions" {
+			result.Source.BodyLineNo = item.Content[i+1].Line
+			if style := item.Content[i+1].Style; style == yaml.LiteralStyle || style == yaml.FoldedStyle {
+				// The text of a block starts on the line after the | or >
+				result.Source.BodyLineNo++
+			}
+		}
+	}
+	return Node{
+		ToolNode: &ToolNode{
+			Tool: result,
+		},
+	}, nil
+}
+
+// Marshal returns the document in a format. The comments of the .gpt format are not kept in the other formats, and
+// an error is returned if the arguments of a tool can not be written in the .gpt format.
+func (d Document) Marshal(format string) ([]byte, error) {
+	switch format {
+	case FormatGPT:
+		for _, node := range d.Nodes {
+			if node.ToolNode == nil {
+				continue
+			}
+			if err := checkArgLines(node.ToolNode.Tool.Arguments); err != nil {
+				return nil, fmt.Errorf("the arguments of tool %q can not be written as Args lines: %w", node.ToolNode.Tool.Name, err)
+			}
+		}
+		return []byte(d.String()), nil
+	case FormatYAML, FormatJSON:
+	case FormatMarkdown:
+		return nil, fmt.Errorf("tools can not be converted to %s", format)
+	default:
+		return nil, fmt.Errorf("unknown format %q, must be one of %s, %s or %s", format, FormatGPT, FormatYAML, FormatJSON)
+	}
+
+	file := structuredFile{
+		Tools: []structuredTool{},
+	}
+	for _, node := range d.Nodes {
+		if node.TextNode != nil {
+			file.Tools = append(file.Tools, structuredTool{
+				Text: node.TextNode.Text,
+			})
+		}
+		if node.ToolNode != nil {
+			file.Tools = append(file.Tools, structuredTool{
+				Parameters:   node.ToolNode.Tool.Parameters,
+				Instructions: node.ToolNode.Tool.Instructions,
+			})
+		}
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Going through a YAML node keeps the fields in the order of types.Tool
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	for _, tool := range root.Content[0].Content[1].Content {
+		// Internal Prompt has no omitempty
+		var content []*yaml.Node
+		for i := 0; i+1 < len(tool.Content); i += 2 {
+			if tool.Content[i+1].Tag != "!!null" {
+				content = append(content, tool.Content[i], tool.Content[i+1])
+			}
+		}
+		tool.Content = content
+	}
+
+	if format == FormatJSON {
+		buf := &bytes.Buffer{}
+		if err := writeJSON(buf, root.Content[0]); err != nil {
+			return nil, err
+		}
+		out := &bytes.Buffer{}
+		if err := json.Indent(out, buf.Bytes(), "", "  "); err != nil {
+			return nil, err
+		}
+		out.WriteString("\n")
+		return out.Bytes(), nil
+	}
+
+	tidy(&root)
+	out := &bytes.Buffer{}
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// tidy restyles JSON read as YAML to block style, with multi-line strings as literal blocks.
+func tidy(node *yaml.Node) {
+	node.Style = 0
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && strings.Contains(node.Value, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	for _, child := range node.Content {
+		tidy(child)
+	}
+}
+
+// writeJSON writes a YAML node read from JSON back as JSON, keeping the order of the fields.
+func writeJSON(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		buf.WriteString("{")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			key, _ := json.Marshal(node.Content[i].Value)
+			buf.Write(key)
+			buf.WriteString(":")
+			if err := writeJSON(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("}")
+	case yaml.SequenceNode:
+		buf.WriteString("[")
+		for i, child := range node.Content {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			if err := writeJSON(buf, child); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]")
+	default:
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const formatInput = `tools: helper, sys.read
+args: name (string, required): who to greet
+args: count (integer, default=2): how many times
+temperature: 0.5
+
+Greet ${name}
+  indented
+with "quotes"
+
+---
+!skip
+name: skipped
+
+---
+name: helper
+description: Helps: a lot
+cache: false
+timeout: 1m30s
+
+#!/bin/bash
+echo "true"
+`
+
+func TestFormatRoundTrip(t *testing.T) {
+	doc, err := Parse(strings.NewReader(formatInput))
+	require.NoError(t, err)
+
+	for _, format := range []string{FormatYAML, FormatJSON} {
+		data, err := doc.Marshal(format)
+		require.NoError(t, err, format)
+
+		converted, err := ParseFormat(bytes.NewReader(data), format)
+		require.NoError(t, err, format)
+		// The comments and order of the header are only kept by the .gpt format
+		assert.Equal(t, withoutHeaders(doc).String(), converted.String(), format)
+		assert.Equal(t, len(doc.Nodes), len(converted.Nodes), format)
+	}
+}
+
+func withoutHeaders(doc Document) (result Document) {
+	for _, node := range doc.Nodes {
+		if node.ToolNode != nil {
+			node = Node{ToolNode: &ToolNode{Tool: node.ToolNode.Tool}}
+		}
+		result.Nodes = append(result.Nodes, node)
+	}
+	return
+}
+
+func TestFormatYAML(t *testing.T) {
+	doc, err := Parse(strings.NewReader(formatInput))
+	require.NoError(t, err)
+
+	data, err := doc.Marshal(FormatYAML)
+	require.NoError(t, err)
+	autogold.Expect(`tools:
+  - temperature: 0.5
+    arguments:
+      properties:
+        count:
+          default: 2
+          description: how many times
+          type: integer
+        name:
+          description: who to greet
+          type: string
+      required:
+        - name
+      type: object
+    tools:
+      - helper
+      - sys.read
+    instructions: |-
+      Greet ${name}
+        indented
+      with "quotes"
+  - text: |+
+      !skip
+      name: skipped
+
+  - name: helper
+    description: 'Helps: a lot'
+    timeout: 1m30s
+    cache: false
+    instructions: |-
+      #!/bin/bash
+      echo "true"
+`).Equal(t, string(data))
+}
+
+func TestParseFormatLines(t *testing.T) {
+	doc, err := ParseFormat(strings.NewReader(`tools:
+- name: first
+  instructions: hi
+- name: second
+  instructions: |
+    #!sys.template
+    {{ .name }}
+`), FormatYAML, Options{Location: "test.gpt.yaml"})
+	require.NoError(t, err)
+
+	tools := doc.Tools()
+	require.Len(t, tools, 2)
+	assert.Equal(t, types.ToolSource{Location: "test.gpt.yaml", LineNo: 2, BodyLineNo: 3}, tools[0].Source)
+	assert.Equal(t, types.ToolSource{Location: "test.gpt.yaml", LineNo: 4, BodyLineNo: 6}, tools[1].Source)
+
+	doc, err = ParseFormat(strings.NewReader("tools:\n- name: slow\n  timeout: 30s\n"), FormatYAML)
+	require.NoError(t, err)
+	assert.Equal(t, types.Duration(30*time.Second), doc.Tools()[0].Timeout)
+
+	_, err = ParseFormat(strings.NewReader("tools:\n- name: first\n- name: second\n  instruction: typo\n"), FormatYAML)
+	errLine := (*ErrLine)(nil)
+	require.True(t, errors.As(err, &errLine))
+	assert.Equal(t, 3, errLine.Line)
+	assert.Contains(t, errLine.Err.Error(), `unknown field "instruction"`)
+
+	_, err = ParseFormat(strings.NewReader(`{"tool": []}`), FormatJSON)
+	assert.ErrorContains(t, err, `unknown field "tool"`)
+}
+
+func TestMarshalArgsLines(t *testing.T) {
+	doc, err := ParseFormat(strings.NewReader(`tools:
+- name: nested
+  arguments:
+    type: object
+    properties:
+      address:
+        type: object
+        properties:
+          city:
+            type: string
+- name: bounded
+  arguments:
+    type: object
+    properties:
+      count:
+        type: integer
+        minimum: 1
+`), FormatYAML)
+	require.NoError(t, err)
+
+	_, err = doc.Marshal(FormatGPT)
+	assert.ErrorContains(t, err, `the arguments of tool "nested" can not be written as Args lines: arg address: properties can not be written`)
+
+	doc.Nodes = doc.Nodes[1:]
+	_, err = doc.Marshal(FormatGPT)
+	assert.ErrorContains(t, err, `arg count: minimum can not be written`)
+
+	doc, err = Parse(strings.NewReader(formatInput))
+	require.NoError(t, err)
+	data, err := doc.Marshal(FormatGPT)
+	require.NoError(t, err)
+	assert.Equal(t, doc.String(), string(data))
+}
+
+func TestFormatOf(t *testing.T) {
+	assert.Equal(t, FormatYAML, FormatOf("dir/tool.gpt.yaml"))
+	assert.Equal(t, FormatYAML, FormatOf("tool.gpt.yml"))
+	assert.Equal(t, FormatJSON, FormatOf("tool.gpt.json"))
+	assert.Equal(t, FormatGPT, FormatOf("tool.gpt"))
+	assert.Equal(t, FormatGPT, FormatOf("config.yaml"))
+}
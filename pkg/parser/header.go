@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// HeaderLine is a line of the header of a tool: a parameter, a comment, or a blank line if neither is set.
+type HeaderLine struct {
+	// Key and Value are the key and value of a parameter as written
+	Key     string `json:"key,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func (h HeaderLine) String() string {
+	if h.Comment != "" {
+		return h.Comment
+	}
+	if h.Key == "" {
+		return ""
+	}
+
+	key, value := h.Key, h.Value
+	if directive, ok := LookupDirective(key); ok {
+		key = directive.Name
+		if directive.ToolRefs {
+			value = strings.Join(csv(value), ", ")
+		}
+	}
+	return strings.TrimSpace(key + ": " + value)
+}
+
+// headerLines returns the lines of a header without the blank lines at its start and end, and with a single blank
+// line between groups.
+func headerLines(header []HeaderLine) (result []string) {
+	for _, h := range header {
+		line := h.String()
+		if line == "" && (len(result) == 0 || result[len(result)-1] == "") {
+			continue
+		}
+		result = append(result, line)
+	}
+	if len(result) > 0 && result[len(result)-1] == "" {
+		result = result[:len(result)-1]
+	}
+	return
+}
+
+// headerText returns the formatted header, or nothing if it only has blank lines.
+func headerText(header []HeaderLine) string {
+	lines := headerLines(header)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// String formats the tool with the comments, blank lines and parameter order of its header. If the tool was
+// changed since it was parsed it is formatted as types.Tool does.
+func (n ToolNode) String() string {
+	if len(n.Header) == 0 || !n.headerMatches() {
+		// A tool without parameters is only its instructions, without the blank line that ends a header
+		return strings.TrimPrefix(n.Tool.String(), "\n")
+	}
+
+	buf := &strings.Builder{}
+	buf.WriteString(headerText(n.Header))
+	if n.Tool.Instructions != "" {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(n.Tool.Instructions)
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// headerMatches returns whether parsing the parameters of the header gives the parameters of the tool.
+func (n ToolNode) headerMatches() bool {
+	var tool types.Tool
+	for _, h := range n.Header {
+		if h.Key == "" {
+			continue
+		}
+		if ok, err := isParam(h.Key+": "+h.Value, &tool); !ok || err != nil {
+			return false
+		}
+	}
+
+	parsed, err := json.Marshal(tool.Parameters)
+	if err != nil {
+		return false
+	}
+	current, err := json.Marshal(n.Tool.Parameters)
+	return err == nil && string(parsed) == string(current)
+}
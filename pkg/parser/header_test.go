@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const unformatted = `#!/usr/bin/env gptscript
+# The main tool
+tools:helper,  sys.read
+
+
+# Who to greet
+args: name: who to greet
+temperature: 0.5
+
+
+Greet ${name}
+
+# Not a comment, part of the body
+
+---
+# Notes about
+# the file
+
+---
+name: helper
+# no cache
+cache: false
+#!/bin/bash
+echo hi
+`
+
+func TestFormatKeepsComments(t *testing.T) {
+	doc, err := Parse(strings.NewReader(unformatted))
+	require.NoError(t, err)
+
+	formatted := doc.String()
+	autogold.Expect(`#!/usr/bin/env gptscript
+# The main tool
+Tools: helper, sys.read
+
+# Who to greet
+Args: name: who to greet
+Temperature: 0.5
+
+Greet ${name}
+
+# Not a comment, part of the body
+
+---
+# Notes about
+# the file
+---
+Name: helper
+# no cache
+Cache: false
+
+#!/bin/bash
+echo hi
+`).Equal(t, formatted)
+
+	doc, err = Parse(strings.NewReader(formatted))
+	require.NoError(t, err)
+	assert.Equal(t, formatted, doc.String())
+}
+
+func TestFormatChangedTool(t *testing.T) {
+	doc, err := Parse(strings.NewReader("# A comment\nname: tool\n\nBody\n"))
+	require.NoError(t, err)
+	require.Equal(t, "# A comment\nName: tool\n\nBody\n", doc.String())
+
+	// A tool changed after it was parsed no longer matches its header, so it is written from the tool
+	doc.Nodes[0].ToolNode.Tool.Description = "Added"
+	assert.Equal(t, "Name: tool\nDescription: Added\n\nBody\n", doc.String())
+}
+
+func TestFormatExamplesTwice(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.gpt")
+	require.NoError(t, err)
+	more, err := filepath.Glob("../../examples/*/*.gpt")
+	require.NoError(t, err)
+	files = append(files, more...)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+
+		doc, err := Parse(bytes.NewReader(data))
+		require.NoError(t, err, file)
+		formatted := doc.String()
+
+		doc, err = Parse(strings.NewReader(formatted))
+		require.NoError(t, err, file)
+		assert.Equal(t, formatted, doc.String(), file)
+	}
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	fenceRegex   = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*([^`\\s]*)")
+	headingRegex = regexp.MustCompile(`^ {0,3}#{1,6}(\s+(.*?))?(\s+#+)?\s*$`)
+)
+
+// parseMarkdown parses the ```gptscript fenced code blocks of a Markdown file as tools. The first tool of a block
+// is named after the heading the block is under if it has no name. Everything outside the blocks is ignored.
+func parseMarkdown(data []byte) (result []Node, _ error) {
+	var (
+		scan    = bufio.NewScanner(bytes.NewReader(data))
+		lineNo  int
+		heading string
+		// fence is the fence of the code block the scan is in, if any, and block the lines of a gptscript block
+		fence      string
+		block      []string
+		blockStart int
+		inScript   bool
+	)
+
+	for scan.Scan() {
+		lineNo++
+		line := scan.Text()
+
+		if fence != "" {
+			if isFenceEnd(line, fence) {
+				if inScript {
+					nodes, err := parseBlock(block, blockStart, heading)
+					if err != nil {
+						return nil, err
+					}
+					result = append(result, nodes...)
+				}
+				fence, block, inScript = "", nil, false
+			} else if inScript {
+				block = append(block, line)
+			}
+			continue
+		}
+
+		if match := fenceRegex.FindStringSubmatch(line); match != nil {
+			fence, inScript, blockStart = match[1], strings.EqualFold(match[2], "gptscript"), lineNo
+		} else if match := headingRegex.FindStringSubmatch(line); match != nil {
+			heading = strings.TrimSpace(match[2])
+		}
+	}
+
+	return result, scan.Err()
+}
+
+func isFenceEnd(line, fence string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, fence) && strings.Trim(line, fence[:1]) == ""
+}
+
+// parseBlock parses the lines of a gptscript block that starts on the line after fenceLine.
+func parseBlock(lines []string, fenceLine int, heading string) ([]Node, error) {
+	// The block is parsed from the fence line, so a #! on its first line is not skipped as an interpreter line
+	nodes, err := parse(strings.NewReader("\n" + strings.Join(lines, "\n")))
+	if errLine := (*ErrLine)(nil); errors.As(err, &errLine) {
+		return nil, NewErrLine(errLine.Path, errLine.Line+fenceLine-1, errLine.Err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	for i, node := range nodes {
+		if node.ToolNode == nil {
+			continue
+		}
+		source := &node.ToolNode.Tool.Source
+		source.LineNo += fenceLine - 1
+		if source.BodyLineNo > 0 {
+			source.BodyLineNo += fenceLine - 1
+		}
+		if i == 0 && node.ToolNode.Tool.Name == "" {
+			node.ToolNode.Tool.Name = heading
+		}
+	}
+	return nodes, nil
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const markdownInput = "# Runbook\n" +
+	"\n" +
+	"Prose about the runbook.\n" +
+	"\n" +
+	"```gptscript\n" +
+	"tools: restart\n" +
+	"\n" +
+	"Restart the service\n" +
+	"```\n" +
+	"\n" +
+	"## Restart ##\n" +
+	"\n" +
+	"````markdown\n" +
+	"# Not a heading\n" +
+	"```gptscript\n" +
+	"Not a tool\n" +
+	"```\n" +
+	"````\n" +
+	"\n" +
+	"~~~gptscript\n" +
+	"#!/bin/bash\n" +
+	"systemctl restart app\n" +
+	"~~~\n" +
+	"\n" +
+	"```bash\n" +
+	"echo not a tool\n" +
+	"```\n"
+
+func TestParseMarkdown(t *testing.T) {
+	doc, err := ParseFormat(strings.NewReader(markdownInput), FormatMarkdown)
+	require.NoError(t, err)
+
+	tools := doc.Tools()
+	require.Len(t, tools, 2)
+
+	assert.Equal(t, "Runbook", tools[0].Name)
+	assert.Equal(t, []string{"restart"}, tools[0].Tools)
+	assert.Equal(t, "Restart the service", tools[0].Instructions)
+	assert.Equal(t, 5, tools[0].Source.LineNo)
+	assert.Equal(t, 8, tools[0].Source.BodyLineNo)
+
+	assert.Equal(t, "Restart", tools[1].Name)
+	assert.Equal(t, "#!/bin/bash\nsystemctl restart app", tools[1].Instructions)
+	assert.Equal(t, 21, tools[1].Source.BodyLineNo)
+}
+
+func TestParseMarkdownErrorLine(t *testing.T) {
+	_, err := ParseFormat(strings.NewReader("# Title\n\n```gptscript\nname: a\nmax tokens: lots\n```\n"), FormatMarkdown)
+	errLine := (*ErrLine)(nil)
+	require.True(t, errors.As(err, &errLine))
+	assert.Equal(t, 5, errLine.Line)
+}
+
+func TestParseMarkdownWithoutBlocks(t *testing.T) {
+	doc, err := ParseFormat(strings.NewReader("# Title\n\nJust prose\n"), FormatMarkdown)
+	require.NoError(t, err)
+	assert.Empty(t, doc.Tools())
+}
@@ -2,12 +2,14 @@ package parser
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gptscript-ai/gptscript/pkg/types"
@@ -48,6 +50,19 @@ func csv(line string) (result []string) {
 	return
 }
 
+// parseModel parses a model with an optional chain of fallbacks, as in "gpt-4o, fallback claude-3-5-sonnet from ./provider.gpt".
+func parseModel(value string) (model string, fallbacks []string, _ error) {
+	parts := csv(value)
+	for _, part := range parts[1:] {
+		fields := strings.Fields(part)
+		if len(fields) < 2 || strings.ToLower(fields[0]) != "fallback" {
+			return "", nil, fmt.Errorf("invalid model fallback %q, expected \"fallback MODEL\"", part)
+		}
+		fallbacks = append(fallbacks, strings.Join(fields[1:], " "))
+	}
+	return parts[0], fallbacks, nil
+}
+
 func addArg(line string, tool *types.Tool) error {
 	if tool.Parameters.Arguments == nil {
 		tool.Parameters.Arguments = &openapi3.Schema{
@@ -61,11 +76,34 @@ func addArg(line string, tool *types.Tool) error {
 		return fmt.Errorf("invalid arg format: %s", line)
 	}
 
+	// Modifiers come in parentheses after the name, as in "count (integer, required, default=3): how many"
+	var modifiers string
+	if name, rest, ok := strings.Cut(line, "("); ok && !strings.Contains(name, ":") {
+		var description string
+		modifiers, description, ok = cutModifiers(rest)
+		description, hasDescription := strings.CutPrefix(strings.TrimSpace(description), ":")
+		if !ok || !hasDescription {
+			return fmt.Errorf("invalid arg format: %s", line)
+		}
+		key, value = strings.TrimSpace(name), description
+	}
+
+	schema := &openapi3.Schema{
+		Description: strings.TrimSpace(value),
+		Type:        "string",
+	}
+	if modifiers != "" {
+		required, err := parseArgModifiers(schema, modifiers)
+		if err != nil {
+			return fmt.Errorf("invalid arg %s: %w", key, err)
+		}
+		if required {
+			tool.Parameters.Arguments.Required = append(tool.Parameters.Arguments.Required, key)
+		}
+	}
+
 	tool.Parameters.Arguments.Properties[key] = &openapi3.SchemaRef{
-		Value: &openapi3.Schema{
-			Description: strings.TrimSpace(value),
-			Type:        "string",
-		},
+		Value: schema,
 	}
 
 	return nil
@@ -83,7 +121,10 @@ func isParam(line string, tool *types.Tool) (_ bool, err error) {
 	case "modelprovider":
 		tool.Parameters.ModelProvider = true
 	case "model", "modelname":
-		tool.Parameters.ModelName = value
+		tool.Parameters.ModelName, tool.Parameters.ModelFallbacks, err = parseModel(value)
+		if err != nil {
+			return false, err
+		}
 	case "globalmodel", "globalmodelname":
 		tool.Parameters.GlobalModelName = value
 	case "description":
@@ -119,6 +160,27 @@ func isParam(line string, tool *types.Tool) (_ bool, err error) {
 		if err != nil {
 			return false, err
 		}
+	case "maxcontext":
+		tool.Parameters.MaxContext, err = strconv.Atoi(value)
+		if err != nil {
+			return false, err
+		}
+	case "maxparallelcalls":
+		tool.Parameters.MaxParallelCalls, err = strconv.Atoi(value)
+		if err != nil {
+			return false, err
+		}
+	case "maxturns":
+		tool.Parameters.MaxTurns, err = strconv.Atoi(value)
+		if err != nil {
+			return false, err
+		}
+	case "timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return false, err
+		}
+		tool.Parameters.Timeout = types.Duration(timeout)
 	case "cache":
 		b, err := toBool(value)
 		if err != nil {
@@ -135,6 +197,15 @@ func isParam(line string, tool *types.Tool) (_ bool, err error) {
 		if err != nil {
 			return false, err
 		}
+	case "outputschema":
+		if strings.HasPrefix(value, "{") {
+			tool.Parameters.OutputSchema = &openapi3.Schema{}
+			if err := json.Unmarshal([]byte(value), tool.Parameters.OutputSchema); err != nil {
+				return false, fmt.Errorf("invalid output schema: %w", err)
+			}
+		} else {
+			tool.Parameters.OutputSchemaRef = value
+		}
 	case "credentials", "creds", "credential", "cred":
 		tool.Parameters.Credentials = append(tool.Parameters.Credentials, csv(strings.ToLower(value))...)
 	default:
@@ -171,6 +242,7 @@ func NewErrLine(path string, lineNo int, err error) error {
 
 type context struct {
 	tool         types.Tool
+	header       []HeaderLine
 	instructions []string
 	inBody       bool
 	skipNode     bool
@@ -187,7 +259,15 @@ func (c *context) finish(tools *[]Node) {
 		c.tool.Chat {
 		*tools = append(*tools, Node{
 			ToolNode: &ToolNode{
-				Tool: c.tool,
+				Tool:   c.tool,
+				Header: c.header,
+			},
+		})
+	} else if text := headerText(c.header); !c.skipNode && text != "" {
+		// A section of only comments is kept as text
+		*tools = append(*tools, Node{
+			TextNode: &TextNode{
+				Text: text,
 			},
 		})
 	}
@@ -238,7 +318,7 @@ func (d Document) String() string {
 		}
 		if node.ToolNode != nil {
 			writeSep(&buf, lastText)
-			buf.WriteString(node.ToolNode.Tool.String())
+			buf.WriteString(node.ToolNode.String())
 			lastText = false
 		}
 	}
@@ -256,30 +336,39 @@ type TextNode struct {
 
 type ToolNode struct {
 	Tool types.Tool `json:"tool,omitempty"`
+	// Header is the header of the tool as it was written, so it can be formatted with its comments and blank lines
+	Header []HeaderLine `json:"header,omitempty"`
 }
 
-func ParseTools(input io.Reader, opts ...Options) (result []types.Tool, _ error) {
-	doc, err := Parse(input, opts...)
-	if err != nil {
-		return nil, err
-	}
-	for _, node := range doc.Nodes {
+// Tools returns the tools of the document, without the text nodes.
+func (d Document) Tools() (result []types.Tool) {
+	for _, node := range d.Nodes {
 		if node.ToolNode != nil {
 			result = append(result, node.ToolNode.Tool)
 		}
 	}
-
 	return
 }
 
+func ParseTools(input io.Reader, opts ...Options) (result []types.Tool, _ error) {
+	doc, err := Parse(input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Tools(), nil
+}
+
 func Parse(input io.Reader, opts ...Options) (Document, error) {
 	nodes, err := parse(input)
 	if err != nil {
 		return Document{}, err
 	}
 
-	opt := complete(opts...)
+	return newDocument(nodes, complete(opts...))
+}
 
+// newDocument sets the location of the tools and assigns the globals, as the options say.
+func newDocument(nodes []Node, opt Options) (_ Document, err error) {
 	if opt.Location != "" {
 		for _, node := range nodes {
 			if node.ToolNode != nil && node.ToolNode.Tool.Source.Location == "" {
@@ -325,7 +414,10 @@ func Parse(input io.Reader, opts ...Options) (Document, error) {
 			continue
 		}
 		if globalModel != "" && node.ToolNode.Tool.ModelName == "" {
-			node.ToolNode.Tool.ModelName = globalModel
+			node.ToolNode.Tool.ModelName, node.ToolNode.Tool.ModelFallbacks, err = parseModel(globalModel)
+			if err != nil {
+				return Document{}, err
+			}
 		}
 		for _, globalTool := range globalTools {
 			if !slices.Contains(node.ToolNode.Tool.Tools, globalTool) {
@@ -374,15 +466,20 @@ func parse(input io.Reader) ([]Node, error) {
 		if !context.inBody {
 			// If the very first line is #! just skip because this is a unix interpreter declaration
 			if strings.HasPrefix(line, "#!") && lineNo == 1 {
+				context.header = append(context.header, HeaderLine{Comment: strings.TrimRight(line, " \t\r\n")})
 				continue
 			}
 
 			// This is a comment
 			if strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "#!") {
+				context.header = append(context.header, HeaderLine{Comment: strings.TrimRight(line, " \t\r\n")})
 				continue
 			}
 
 			if !context.seenParam && skipRegex.MatchString(line) {
+				if text := headerText(context.header); text != "" {
+					context.skipLines = append(context.skipLines, text)
+				}
 				context.skipLines = append(context.skipLines, line)
 				context.skipNode = true
 				continue
@@ -390,6 +487,7 @@ func parse(input io.Reader) ([]Node, error) {
 
 			// Blank line
 			if strings.TrimSpace(line) == "" {
+				context.header = append(context.header, HeaderLine{})
 				continue
 			}
 
@@ -397,11 +495,19 @@ func parse(input io.Reader) ([]Node, error) {
 			if isParam, err := isParam(line, &context.tool); err != nil {
 				return nil, NewErrLine("", lineNo, err)
 			} else if isParam {
+				key, value, _ := strings.Cut(line, ":")
+				context.header = append(context.header, HeaderLine{
+					Key:   strings.TrimSpace(key),
+					Value: strings.TrimSpace(value),
+				})
 				context.seenParam = true
 				continue
 			}
 		}
 
+		if !context.inBody {
+			context.tool.Source.BodyLineNo = lineNo
+		}
 		context.inBody = true
 		context.instructions = append(context.instructions, line)
 	}
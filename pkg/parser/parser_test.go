@@ -3,6 +3,7 @@ package parser
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/hexops/autogold/v2"
@@ -38,18 +39,41 @@ tools: bar
 				},
 				Source: types.ToolSource{LineNo: 1},
 			},
+			Header: []HeaderLine{
+				{},
+				{
+					Key:   "global tools",
+					Value: "foo, bar",
+				},
+				{
+					Key:   "global model",
+					Value: "the model",
+				},
+			},
 		}},
-		{ToolNode: &ToolNode{Tool: types.Tool{
-			Parameters: types.Parameters{
-				Name:      "bar",
-				ModelName: "the model",
-				Tools: []string{
-					"bar",
-					"foo",
+		{ToolNode: &ToolNode{
+			Tool: types.Tool{
+				Parameters: types.Parameters{
+					Name:      "bar",
+					ModelName: "the model",
+					Tools: []string{
+						"bar",
+						"foo",
+					},
 				},
+				Source: types.ToolSource{LineNo: 5},
 			},
-			Source: types.ToolSource{LineNo: 5},
-		}}},
+			Header: []HeaderLine{
+				{
+					Key:   "name",
+					Value: "bar",
+				},
+				{
+					Key:   "tools",
+					Value: "bar",
+				},
+			},
+		}},
 	}}).Equal(t, out)
 }
 
@@ -92,25 +116,54 @@ name: seven
 			Tool: types.Tool{
 				Instructions: "first",
 				Source: types.ToolSource{
-					LineNo: 1,
+					LineNo:     1,
+					BodyLineNo: 2,
 				},
 			},
+			Header: []HeaderLine{{}},
+		}},
+		{ToolNode: &ToolNode{
+			Tool: types.Tool{
+				Parameters: types.Parameters{Name: "second"},
+				Source:     types.ToolSource{LineNo: 4},
+			},
+			Header: []HeaderLine{{
+				Key:   "name",
+				Value: "second",
+			}},
 		}},
-		{ToolNode: &ToolNode{Tool: types.Tool{
-			Parameters: types.Parameters{Name: "second"},
-			Source:     types.ToolSource{LineNo: 4},
-		}}},
 		{TextNode: &TextNode{Text: "!third\n\nname: third\n"}},
-		{ToolNode: &ToolNode{Tool: types.Tool{
-			Parameters:   types.Parameters{Name: "fourth"},
-			Instructions: "!forth dont skip",
-			Source:       types.ToolSource{LineNo: 11},
-		}}},
-		{ToolNode: &ToolNode{Tool: types.Tool{
-			Parameters:   types.Parameters{Name: "fifth"},
-			Instructions: "#!ignore",
-			Source:       types.ToolSource{LineNo: 14},
-		}}},
+		{ToolNode: &ToolNode{
+			Tool: types.Tool{
+				Parameters:   types.Parameters{Name: "fourth"},
+				Instructions: "!forth dont skip",
+				Source: types.ToolSource{
+					LineNo:     11,
+					BodyLineNo: 12,
+				},
+			},
+			Header: []HeaderLine{{
+				Key:   "name",
+				Value: "fourth",
+			}},
+		}},
+		{ToolNode: &ToolNode{
+			Tool: types.Tool{
+				Parameters:   types.Parameters{Name: "fifth"},
+				Instructions: "#!ignore",
+				Source: types.ToolSource{
+					LineNo:     14,
+					BodyLineNo: 16,
+				},
+			},
+			Header: []HeaderLine{
+				{
+					Key:   "name",
+					Value: "fifth",
+				},
+				{},
+			},
+		}},
 		{TextNode: &TextNode{Text: `!skip
 name: six
 
@@ -123,11 +176,168 @@ name: bad
 ---
 name: bad
 `}},
-		{ToolNode: &ToolNode{Tool: types.Tool{
-			Parameters: types.Parameters{
-				Name: "seven",
+		{ToolNode: &ToolNode{
+			Tool: types.Tool{
+				Parameters: types.Parameters{
+					Name: "seven",
+				},
+				Source: types.ToolSource{LineNo: 30},
 			},
-			Source: types.ToolSource{LineNo: 30},
-		}}},
+			Header: []HeaderLine{{
+				Key:   "name",
+				Value: "seven",
+			}},
+		}},
 	}}).Equal(t, out)
 }
+
+func TestParseModelFallback(t *testing.T) {
+	var input = `
+name: first
+model: gpt-4o, fallback claude-3-5-sonnet from ./provider.gpt, Fallback gpt-4o-mini
+`
+	out, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 1)
+
+	tool := out.Nodes[0].ToolNode.Tool
+	require.Equal(t, "gpt-4o", tool.ModelName)
+	require.Equal(t, []string{"claude-3-5-sonnet from ./provider.gpt", "gpt-4o-mini"}, tool.ModelFallbacks)
+	autogold.Expect("Name: first\nModel: gpt-4o, fallback claude-3-5-sonnet from ./provider.gpt, fallback gpt-4o-mini\n").Equal(t, tool.String())
+
+	_, err = Parse(strings.NewReader("model: gpt-4o, claude-3-5-sonnet\n"))
+	require.ErrorContains(t, err, `invalid model fallback "claude-3-5-sonnet"`)
+}
+
+func TestParseOutputSchema(t *testing.T) {
+	var input = `
+name: first
+output schema: {"type": "object", "properties": {"name": {"type": "string"}}}
+
+---
+name: second
+output schema: ./schema.json
+`
+	out, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 2)
+
+	first := out.Nodes[0].ToolNode.Tool
+	require.NotNil(t, first.OutputSchema)
+	require.Equal(t, "object", first.OutputSchema.Type)
+	require.Equal(t, "string", first.OutputSchema.Properties["name"].Value.Type)
+	autogold.Expect("Name: first\nOutput Schema: {\"properties\":{\"name\":{\"type\":\"string\"}},\"type\":\"object\"}\n").Equal(t, first.String())
+
+	second := out.Nodes[1].ToolNode.Tool
+	require.Nil(t, second.OutputSchema)
+	require.Equal(t, "./schema.json", second.OutputSchemaRef)
+
+	_, err = Parse(strings.NewReader("output schema: {\"type\": \n"))
+	require.ErrorContains(t, err, "invalid output schema")
+}
+
+func TestParseTimeout(t *testing.T) {
+	out, err := Parse(strings.NewReader("name: slow\ntimeout: 1m30s\n"))
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 1)
+
+	tool := out.Nodes[0].ToolNode.Tool
+	require.Equal(t, types.Duration(90*time.Second), tool.Timeout)
+	autogold.Expect("Name: slow\nTimeout: 1m30s\n").Equal(t, tool.String())
+
+	_, err = Parse(strings.NewReader("timeout: 30\n"))
+	require.Error(t, err)
+}
+
+func TestParseArgModifiers(t *testing.T) {
+	var input = `
+name: typed
+args: name: who to greet
+args: count (integer, required, default=3): how many times
+args: color (enum=red|green|blue, default=green): the color (of the greeting)
+args: ratio (number): a ratio
+args: loud (boolean, default=false): shout
+args: tags (array of integer, default=[1, 2]): some tags
+args: options (object, default={"a": "b, c"}): more options
+`
+	out, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 1)
+
+	tool := out.Nodes[0].ToolNode.Tool
+	props := tool.Arguments.Properties
+	require.Equal(t, []string{"count"}, tool.Arguments.Required)
+	require.Equal(t, "integer", props["count"].Value.Type)
+	require.Equal(t, 3, props["count"].Value.Default)
+	require.Equal(t, "how many times", props["count"].Value.Description)
+	require.Equal(t, []any{"red", "green", "blue"}, props["color"].Value.Enum)
+	require.Equal(t, "the color (of the greeting)", props["color"].Value.Description)
+	require.Equal(t, "integer", props["tags"].Value.Items.Value.Type)
+	require.Equal(t, []any{float64(1), float64(2)}, props["tags"].Value.Default)
+	require.Equal(t, map[string]any{"a": "b, c"}, props["options"].Value.Default)
+
+	autogold.Expect(`Name: typed
+Args: color (enum=red|green|blue, default=green): the color (of the greeting)
+Args: count (integer, required, default=3): how many times
+Args: loud (boolean, default=false): shout
+Args: name: who to greet
+Args: options (object, default={"a":"b, c"}): more options
+Args: ratio (number): a ratio
+Args: tags (array of integer, default=[1,2]): some tags
+`).Equal(t, tool.String())
+
+	// The formatted tool parses back to the same arguments
+	again, err := Parse(strings.NewReader(tool.String()))
+	require.NoError(t, err)
+	require.Equal(t, tool.Arguments, again.Nodes[0].ToolNode.Tool.Arguments)
+
+	for _, invalid := range []string{
+		"args: count (integer, default=three): how many",
+		"args: count (int): how many",
+		"args: count (integer: how many",
+		"args: size (enum=1|x, integer): a size",
+	} {
+		_, err = Parse(strings.NewReader(invalid))
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestParseArgQuotedValues(t *testing.T) {
+	out, err := Parse(strings.NewReader(`name: quoted
+args: greeting (default="hello, world"): the greeting
+args: mood (enum="happy | sad"|"(none)"|plain): the mood
+`))
+	require.NoError(t, err)
+
+	tool := out.Nodes[0].ToolNode.Tool
+	props := tool.Arguments.Properties
+	require.Equal(t, "hello, world", props["greeting"].Value.Default)
+	require.Equal(t, []any{"happy | sad", "(none)", "plain"}, props["mood"].Value.Enum)
+
+	autogold.Expect(`Name: quoted
+Args: greeting (default="hello, world"): the greeting
+Args: mood (enum="happy | sad"|"(none)"|plain): the mood
+`).Equal(t, tool.String())
+
+	again, err := Parse(strings.NewReader(tool.String()))
+	require.NoError(t, err)
+	require.Equal(t, tool.Arguments, again.Nodes[0].ToolNode.Tool.Arguments)
+
+	_, err = Parse(strings.NewReader("name: quoted\nargs: greeting (default=\"hello): the greeting\n"))
+	require.Error(t, err)
+}
+
+func TestDirectivesMatchParser(t *testing.T) {
+	for _, directive := range Directives {
+		for _, key := range append([]string{directive.Name}, directive.Aliases...) {
+			isParam, err := isParam(key+": x", &types.Tool{})
+			// An invalid value is fine, it shows the key was recognized
+			require.True(t, isParam || err != nil, key)
+		}
+	}
+
+	_, ok := LookupDirective("max  tokens")
+	require.True(t, ok)
+	_, ok = LookupDirective("unknown")
+	require.False(t, ok)
+}
@@ -0,0 +1,105 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// invalidArguments is returned to the model, as the result of a tool call, when the arguments of the call do
+// not match the arguments of the tool.
+type invalidArguments struct {
+	Error    string            `json:"error"`
+	Tool     string            `json:"tool"`
+	Problems []argumentProblem `json:"problems"`
+}
+
+type argumentProblem struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// validateArguments checks the input of a tool call against the arguments of the tool. It returns nil if the
+// input is valid or the tool takes any input. Plain text input, which tools also accept, is not validated.
+// Missing arguments with a default are valid, as the engine adds their default when it runs the tool.
+func validateArguments(tool types.Tool, input string) *invalidArguments {
+	trimmed := strings.TrimSpace(engine.ApplyArgDefaults(tool, input))
+	if tool.Arguments == nil || (trimmed != "" && !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[")) {
+		return nil
+	}
+
+	invalid := &invalidArguments{
+		Error: "invalid arguments, fix them and call the tool again",
+		Tool:  tool.Name,
+	}
+
+	var value any = map[string]any{}
+	if trimmed != "" {
+		if err := json.Unmarshal([]byte(trimmed), &value); err != nil {
+			invalid.Problems = append(invalid.Problems, argumentProblem{
+				Path:   "/",
+				Reason: "arguments are not a valid JSON object: " + err.Error(),
+			})
+			return invalid
+		}
+	}
+
+	coerceStrings(tool.Arguments, value)
+	if err := tool.Arguments.VisitJSON(value, openapi3.MultiErrors()); err != nil {
+		invalid.Problems = argumentProblems(err)
+		return invalid
+	}
+	return nil
+}
+
+// coerceStrings converts the numbers and booleans of string arguments to strings, as tools get every argument as
+// a string anyway.
+func coerceStrings(schema *openapi3.Schema, value any) {
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return
+	}
+	for name, prop := range schema.Properties {
+		if prop.Value == nil || prop.Value.Type != "string" {
+			continue
+		}
+		switch v := obj[name].(type) {
+		case float64:
+			obj[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			obj[name] = strconv.FormatBool(v)
+		}
+	}
+}
+
+func argumentProblems(err error) (result []argumentProblem) {
+	var multiErr openapi3.MultiError
+	if errors.As(err, &multiErr) {
+		for _, err := range multiErr {
+			result = append(result, argumentProblems(err)...)
+		}
+		return
+	}
+
+	path, reason, ok := schemaErrorReason(err)
+	if !ok {
+		path, reason = "/", err.Error()
+	}
+	return append(result, argumentProblem{
+		Path:   path,
+		Reason: reason,
+	})
+}
+
+func (a *invalidArguments) String() string {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return "ERROR: " + a.Error
+	}
+	return string(data)
+}
@@ -0,0 +1,40 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateArguments(t *testing.T) {
+	tool := types.Tool{
+		Parameters: types.Parameters{
+			Name: "greet",
+			Arguments: &openapi3.Schema{
+				Type:     "object",
+				Required: []string{"name"},
+				Properties: openapi3.Schemas{
+					"name":  openapi3.NewStringSchema().NewRef(),
+					"count": openapi3.NewIntegerSchema().NewRef(),
+				},
+			},
+		},
+	}
+
+	assert.Nil(t, validateArguments(tool, `{"name": "Bob", "count": 2}`))
+	assert.Nil(t, validateArguments(tool, "Bob"))
+	assert.Nil(t, validateArguments(types.Tool{}, `{"name": 42}`))
+	// Tools get every argument as a string, so numbers and booleans are valid strings
+	assert.Nil(t, validateArguments(tool, `{"name": 42}`))
+	assert.Nil(t, validateArguments(tool, `{"name": true, "count": 2}`))
+
+	autogold.Expect(`{"error":"invalid arguments, fix them and call the tool again","tool":"greet","problems":[{"path":"/","reason":"arguments are not a valid JSON object: unexpected end of JSON input"}]}`).
+		Equal(t, validateArguments(tool, `{"name": "Bob"`).String())
+	autogold.Expect(`{"error":"invalid arguments, fix them and call the tool again","tool":"greet","problems":[{"path":"/name","reason":"property \"name\" is missing"}]}`).
+		Equal(t, validateArguments(tool, "").String())
+	autogold.Expect(`{"error":"invalid arguments, fix them and call the tool again","tool":"greet","problems":[{"path":"/count","reason":"value must be an integer"},{"path":"/name","reason":"value must be a string"}]}`).
+		Equal(t, validateArguments(tool, `{"name": ["Bob"], "count": "two"}`).String())
+}
@@ -0,0 +1,213 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// Price is the cost of a model in USD per million tokens. Cached is the price of prompt tokens served
+// from the provider's prompt cache, if not set cached tokens are charged as regular prompt tokens.
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+	Cached     float64 `json:"cached,omitempty"`
+}
+
+func (p Price) Cost(usage types.Usage) float64 {
+	cachedPrice := p.Cached
+	if cachedPrice == 0 {
+		cachedPrice = p.Prompt
+	}
+	return (float64(usage.PromptTokens-usage.CachedTokens)*p.Prompt +
+		float64(usage.CachedTokens)*cachedPrice +
+		float64(usage.CompletionTokens)*p.Completion) / 1_000_000
+}
+
+// PriceTable maps a model name to its price. A model that is not found by its exact name will use
+// the entry with the longest matching prefix, so "gpt-4o" also prices "gpt-4o-2024-08-06".
+type PriceTable map[string]Price
+
+var DefaultPrices = PriceTable{
+	"gpt-4o":            {Prompt: 2.50, Completion: 10, Cached: 1.25},
+	"gpt-4o-mini":       {Prompt: 0.15, Completion: 0.60, Cached: 0.075},
+	"gpt-4-turbo":       {Prompt: 10, Completion: 30},
+	"gpt-4":             {Prompt: 30, Completion: 60},
+	"gpt-3.5-turbo":     {Prompt: 0.50, Completion: 1.50},
+	"o1":                {Prompt: 15, Completion: 60, Cached: 7.50},
+	"o1-mini":           {Prompt: 3, Completion: 12, Cached: 1.50},
+	"claude-3-5-sonnet": {Prompt: 3, Completion: 15, Cached: 0.30},
+	"claude-3-5-haiku":  {Prompt: 0.80, Completion: 4, Cached: 0.08},
+	"claude-3-opus":     {Prompt: 15, Completion: 75, Cached: 1.50},
+	"claude-3-haiku":    {Prompt: 0.25, Completion: 1.25, Cached: 0.03},
+}
+
+// ReadPriceTable reads a JSON price table from a file and merges it over the default prices.
+func ReadPriceTable(file string) (PriceTable, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table %s: %w", file, err)
+	}
+
+	var prices PriceTable
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("failed to parse price table %s: %w", file, err)
+	}
+
+	return DefaultPrices.Merge(prices), nil
+}
+
+func (p PriceTable) Merge(other PriceTable) PriceTable {
+	result := PriceTable{}
+	for k, v := range p {
+		result[k] = v
+	}
+	for k, v := range other {
+		result[k] = v
+	}
+	return result
+}
+
+func (p PriceTable) Lookup(model string) (Price, bool) {
+	// Models from a remote provider are referenced as "model from provider"
+	model, _, _ = strings.Cut(model, " from ")
+	model = strings.TrimSpace(model)
+
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+
+	var (
+		match string
+		price Price
+	)
+	for name, v := range p {
+		if strings.HasPrefix(model, name) && len(name) > len(match) {
+			match, price = name, v
+		}
+	}
+	return price, match != ""
+}
+
+const (
+	BudgetTokens = "tokens"
+	BudgetCost   = "cost"
+)
+
+// ErrBudgetExceeded is returned when a run uses more tokens or money than it was allowed to. State is
+// the state of the call that was stopped and can be used to inspect how far the run got.
+type ErrBudgetExceeded struct {
+	Budget string      `json:"budget,omitempty"`
+	Limit  float64     `json:"limit,omitempty"`
+	Used   float64     `json:"used,omitempty"`
+	Usage  types.Usage `json:"usage,omitempty"`
+	Cost   float64     `json:"cost,omitempty"`
+	State  *State      `json:"state,omitempty"`
+}
+
+func (e *ErrBudgetExceeded) Error() string {
+	if e.Budget == BudgetCost {
+		return fmt.Sprintf("cost budget exceeded: used $%.4f of $%.4f", e.Used, e.Limit)
+	}
+	return fmt.Sprintf("token budget exceeded: used %d of %d tokens", int64(e.Used), int64(e.Limit))
+}
+
+// budget tracks the usage and cost of a single run against the configured limits.
+type budget struct {
+	lock      sync.Mutex
+	maxTokens int64
+	maxCost   float64
+	prices    PriceTable
+	usage     types.Usage
+	cost      float64
+	err       error
+}
+
+type budgetKey struct{}
+
+func withBudget(ctx context.Context, b *budget) context.Context {
+	if b == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+func getBudget(ctx context.Context) *budget {
+	b, _ := ctx.Value(budgetKey{}).(*budget)
+	return b
+}
+
+func (r *Runner) newBudget() *budget {
+	if r.maxTokensTotal <= 0 && r.maxCost <= 0 {
+		return nil
+	}
+	return &budget{
+		maxTokens: r.maxTokensTotal,
+		maxCost:   r.maxCost,
+		prices:    r.prices,
+	}
+}
+
+func (b *budget) add(model string, usage types.Usage) {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.usage = b.usage.Add(usage)
+	if b.maxCost <= 0 {
+		return
+	}
+
+	price, ok := b.prices.Lookup(model)
+	if !ok && b.err == nil {
+		b.err = fmt.Errorf("a cost budget is set but there is no price configured for model %q", model)
+	}
+	b.cost += price.Cost(usage)
+}
+
+// check returns an error if the run has gone over one of its limits. The state is attached to the
+// returned error so that the caller has a dump of the work done so far.
+func (b *budget) check(state *State) error {
+	if b == nil {
+		return nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.err != nil {
+		return b.err
+	}
+
+	if b.maxTokens > 0 && int64(b.usage.TotalTokens) > b.maxTokens {
+		return &ErrBudgetExceeded{
+			Budget: BudgetTokens,
+			Limit:  float64(b.maxTokens),
+			Used:   float64(b.usage.TotalTokens),
+			Usage:  b.usage,
+			Cost:   b.cost,
+			State:  state,
+		}
+	}
+
+	if b.maxCost > 0 && b.cost > b.maxCost {
+		return &ErrBudgetExceeded{
+			Budget: BudgetCost,
+			Limit:  b.maxCost,
+			Used:   b.cost,
+			Usage:  b.usage,
+			Cost:   b.cost,
+			State:  state,
+		}
+	}
+
+	return nil
+}
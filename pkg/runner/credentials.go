@@ -1,9 +1,14 @@
 package runner
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"os"
 	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
 )
 
 // parseCredentialOverrides parses a string of credential overrides that the user provided as a command line arg.
@@ -53,3 +58,43 @@ func parseCredentialOverrides(override string) (map[string]map[string]string, er
 
 	return credentialOverrides, nil
 }
+
+// CredentialEnv returns the environment variables set by the credential tool of prg when it is not used by a
+// tool, such as the credential of a model alias. Overrides and stored credentials are used as for tools.
+func (r *Runner) CredentialEnv(ctx context.Context, prg types.Program, env []string) (_ map[string]string, err error) {
+	credToolName := prg.Name
+	tool := types.Tool{
+		ID: "credential of " + credToolName,
+		Parameters: types.Parameters{
+			Credentials: []string{credToolName},
+		},
+		ToolMapping: map[string]string{
+			credToolName: prg.EntryToolID,
+		},
+	}
+
+	prg.ToolSet = maps.Clone(prg.ToolSet)
+	prg.ToolSet[tool.ID] = tool
+	prg.EntryToolID = tool.ID
+
+	monitor, err := r.factory.Start(ctx, &prg, env, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		monitor.Stop("", err)
+	}()
+
+	credEnv, err := r.handleCredentials(engine.NewContext(ctx, &prg), monitor, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// The variables set by the credential are appended to env
+	result := map[string]string{}
+	for _, e := range credEnv[len(env):] {
+		k, v, _ := strings.Cut(e, "=")
+		result[k] = v
+	}
+	return result, nil
+}
@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const outputSchemaRetryPrompt = `Your response is invalid, %v.
+Respond again with only the corrected JSON.`
+
+// validateOutput checks the result of a tool against its output schema. The JSON is returned without the
+// markdown code fence models often wrap it in.
+func validateOutput(tool types.Tool, result string) (string, error) {
+	schema := tool.Parameters.OutputSchema
+	if schema == nil {
+		return result, nil
+	}
+
+	output := stripCodeFence(result)
+
+	var value any
+	if err := json.Unmarshal([]byte(output), &value); err != nil {
+		return result, fmt.Errorf("output is not valid JSON: %w", err)
+	}
+	if err := schema.VisitJSON(value); err != nil {
+		if path, reason, ok := schemaErrorReason(err); ok {
+			return result, fmt.Errorf("output does not match the output schema at %s: %s", path, reason)
+		}
+		return result, fmt.Errorf("output does not match the output schema: %w", err)
+	}
+	return output, nil
+}
+
+// schemaErrorReason returns the JSON pointer and reason of a schema error, as its default message includes the
+// whole schema and value.
+func schemaErrorReason(err error) (path, reason string, ok bool) {
+	var schemaErr *openapi3.SchemaError
+	if !errors.As(err, &schemaErr) {
+		return "", "", false
+	}
+	return "/" + strings.Join(schemaErr.JSONPointer(), "/"), schemaErr.Reason, true
+}
+
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") {
+		return text
+	}
+	_, body, ok := strings.Cut(text, "\n")
+	if !ok {
+		return text
+	}
+	return strings.TrimSpace(strings.TrimSuffix(body, "```"))
+}
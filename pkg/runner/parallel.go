@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 type dispatcher interface {
@@ -33,25 +34,80 @@ func (s *serialDispatcher) Wait() error {
 	return s.err
 }
 
+type (
+	concurrencyKey struct{}
+	heldSlotKey    struct{}
+)
+
+// withConcurrency limits the number of calls of a run that can be active at the same time, across all levels
+// of sub-calls.
+func withConcurrency(ctx context.Context, maxConcurrency int64) context.Context {
+	if maxConcurrency <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, concurrencyKey{}, semaphore.NewWeighted(maxConcurrency))
+}
+
+func getConcurrency(ctx context.Context) *semaphore.Weighted {
+	s, _ := ctx.Value(concurrencyKey{}).(*semaphore.Weighted)
+	return s
+}
+
 type parallelDispatcher struct {
 	ctx context.Context
 	eg  *errgroup.Group
+	// shared is the limit of the whole run, local the limit of the calls of this dispatcher
+	shared *semaphore.Weighted
+	local  *semaphore.Weighted
 }
 
-func newParallelDispatcher(ctx context.Context) *parallelDispatcher {
-	eg, ctx := errgroup.WithContext(ctx)
-	return &parallelDispatcher{
-		ctx: ctx,
-		eg:  eg,
+func newParallelDispatcher(ctx context.Context, maxParallelCalls int) *parallelDispatcher {
+	eg, egCtx := errgroup.WithContext(ctx)
+	d := &parallelDispatcher{
+		ctx:    egCtx,
+		eg:     eg,
+		shared: getConcurrency(ctx),
+	}
+	if maxParallelCalls > 0 {
+		d.local = semaphore.NewWeighted(int64(maxParallelCalls))
 	}
+	return d
 }
 
 func (p *parallelDispatcher) Run(f func(context.Context) error) {
 	p.eg.Go(func() error {
-		return f(p.ctx)
+		if p.local != nil {
+			if err := p.local.Acquire(p.ctx, 1); err != nil {
+				return err
+			}
+			defer p.local.Release(1)
+		}
+
+		ctx := p.ctx
+		if p.shared != nil {
+			if err := p.shared.Acquire(ctx, 1); err != nil {
+				return err
+			}
+			defer p.shared.Release(1)
+			ctx = context.WithValue(ctx, heldSlotKey{}, true)
+		}
+
+		return f(ctx)
 	})
 }
 
+// Wait gives back the slot of the calling sub-call while its own sub-calls run, otherwise nested calls could
+// wait forever on slots held by their parents.
 func (p *parallelDispatcher) Wait() error {
+	held, _ := p.ctx.Value(heldSlotKey{}).(bool)
+	if p.shared == nil || !held {
+		return p.eg.Wait()
+	}
+
+	p.shared.Release(1)
+	defer func() {
+		// The slot must be taken back even if the run was canceled, as the caller will release it
+		_ = p.shared.Acquire(context.WithoutCancel(p.ctx), 1)
+	}()
 	return p.eg.Wait()
 }
@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type activeCounter struct {
+	lock    sync.Mutex
+	active  int
+	maximum int
+}
+
+func (a *activeCounter) run() {
+	a.lock.Lock()
+	a.active++
+	a.maximum = max(a.maximum, a.active)
+	a.lock.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	a.lock.Lock()
+	a.active--
+	a.lock.Unlock()
+}
+
+func TestParallelDispatcherMaxParallelCalls(t *testing.T) {
+	var counter activeCounter
+
+	d := newParallelDispatcher(context.Background(), 2)
+	for i := 0; i < 10; i++ {
+		d.Run(func(context.Context) error {
+			counter.run()
+			return nil
+		})
+	}
+	require.NoError(t, d.Wait())
+	assert.Equal(t, 2, counter.maximum)
+}
+
+func TestParallelDispatcherSharedLimit(t *testing.T) {
+	var (
+		counter activeCounter
+		calls   atomic.Int32
+		ctx     = withConcurrency(context.Background(), 3)
+	)
+
+	// Every call makes its own parallel sub-calls, which must not wait forever on the slots of their parents
+	var dispatch func(ctx context.Context, depth int) error
+	dispatch = func(ctx context.Context, depth int) error {
+		d := newParallelDispatcher(ctx, 0)
+		for i := 0; i < 3; i++ {
+			d.Run(func(ctx context.Context) error {
+				calls.Add(1)
+				counter.run()
+				if depth < 2 {
+					return dispatch(ctx, depth+1)
+				}
+				return nil
+			})
+		}
+		return d.Wait()
+	}
+
+	require.NoError(t, dispatch(ctx, 0))
+	assert.Equal(t, int32(3+9+27), calls.Load())
+	assert.LessOrEqual(t, counter.maximum, 3)
+}
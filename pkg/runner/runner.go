@@ -36,6 +36,14 @@ type Options struct {
 	EndPort            int64                 `usage:"-"`
 	CredentialOverride string                `usage:"-"`
 	Sequential         bool                  `usage:"-"`
+	MaxTokensTotal     int64                 `usage:"-"`
+	MaxCost            float64               `usage:"-"`
+	Prices             PriceTable            `usage:"-"`
+	ContextStrategy    string                `usage:"-"`
+	MaxConcurrency     int64                 `usage:"-"`
+	MaxTurns           int                   `usage:"-"`
+	MaxTurnsAction     string                `usage:"-"`
+	Timeout            time.Duration         `usage:"-"`
 }
 
 func complete(opts ...Options) (result Options) {
@@ -46,6 +54,22 @@ func complete(opts ...Options) (result Options) {
 		result.EndPort = types.FirstSet(opt.EndPort, result.EndPort)
 		result.CredentialOverride = types.FirstSet(opt.CredentialOverride, result.CredentialOverride)
 		result.Sequential = types.FirstSet(opt.Sequential, result.Sequential)
+		result.MaxTokensTotal = types.FirstSet(opt.MaxTokensTotal, result.MaxTokensTotal)
+		result.MaxCost = types.FirstSet(opt.MaxCost, result.MaxCost)
+		result.ContextStrategy = types.FirstSet(opt.ContextStrategy, result.ContextStrategy)
+		result.MaxConcurrency = types.FirstSet(opt.MaxConcurrency, result.MaxConcurrency)
+		result.MaxTurns = types.FirstSet(opt.MaxTurns, result.MaxTurns)
+		result.MaxTurnsAction = types.FirstSet(opt.MaxTurnsAction, result.MaxTurnsAction)
+		result.Timeout = types.FirstSet(opt.Timeout, result.Timeout)
+		if result.Prices == nil {
+			result.Prices = opt.Prices
+		}
+	}
+	if result.Prices == nil {
+		result.Prices = DefaultPrices
+	}
+	if result.MaxTurnsAction == "" {
+		result.MaxTurnsAction = MaxTurnsError
 	}
 	if result.MonitorFactory == nil {
 		result.MonitorFactory = noopFactory{}
@@ -68,6 +92,14 @@ type Runner struct {
 	credMutex      sync.Mutex
 	credOverrides  string
 	sequential     bool
+	maxTokensTotal int64
+	maxCost        float64
+	prices         PriceTable
+	strategy       engine.ContextStrategy
+	maxConcurrency int64
+	maxTurns       int
+	maxTurnsAction string
+	timeout        time.Duration
 }
 
 func New(client engine.Model, credCtx string, opts ...Options) (*Runner, error) {
@@ -81,6 +113,25 @@ func New(client engine.Model, credCtx string, opts ...Options) (*Runner, error)
 		credMutex:      sync.Mutex{},
 		credOverrides:  opt.CredentialOverride,
 		sequential:     opt.Sequential,
+		maxTokensTotal: opt.MaxTokensTotal,
+		maxCost:        opt.MaxCost,
+		prices:         opt.Prices,
+		maxConcurrency: opt.MaxConcurrency,
+		maxTurns:       opt.MaxTurns,
+		maxTurnsAction: opt.MaxTurnsAction,
+		timeout:        opt.Timeout,
+	}
+
+	if opt.MaxTurnsAction != MaxTurnsError && opt.MaxTurnsAction != MaxTurnsWrapUp {
+		return nil, fmt.Errorf("invalid max turns action %q, expected %s or %s", opt.MaxTurnsAction, MaxTurnsError, MaxTurnsWrapUp)
+	}
+
+	if opt.ContextStrategy != "" {
+		strategy, ok := engine.ContextStrategies[opt.ContextStrategy]
+		if !ok {
+			return nil, fmt.Errorf("invalid context strategy: %s", opt.ContextStrategy)
+		}
+		runner.strategy = strategy
 	}
 
 	if opt.StartPort != 0 {
@@ -133,7 +184,7 @@ func (r *Runner) Chat(ctx context.Context, prevState ChatState, prg types.Progra
 		monitor.Stop(resp.Content, err)
 	}()
 
-	callCtx := engine.NewContext(ctx, &prg)
+	callCtx := engine.NewContext(withConcurrency(withBudget(ctx, r.newBudget()), r.maxConcurrency), &prg)
 	if state == nil || state.StartContinuation {
 		if state != nil {
 			state = state.WithResumeInput(&input)
@@ -194,10 +245,14 @@ type Event struct {
 	ToolResults        int                    `json:"toolResults,omitempty"`
 	Type               EventType              `json:"type,omitempty"`
 	ChatCompletionID   string                 `json:"chatCompletionId,omitempty"`
+	ChatModel          string                 `json:"chatModel,omitempty"`
 	ChatRequest        any                    `json:"chatRequest,omitempty"`
 	ChatResponse       any                    `json:"chatResponse,omitempty"`
 	ChatResponseCached bool                   `json:"chatResponseCached,omitempty"`
+	Usage              *types.Usage           `json:"usage,omitempty"`
+	Retry              *types.CompletionRetry `json:"retry,omitempty"`
 	Content            string                 `json:"content,omitempty"`
+	Turns              int                    `json:"turns,omitempty"`
 }
 
 type EventType string
@@ -208,9 +263,17 @@ var (
 	EventTypeCallSubCalls = EventType("callSubCalls")
 	EventTypeCallProgress = EventType("callProgress")
 	EventTypeChat         = EventType("callChat")
+	EventTypeCallRetry    = EventType("callRetry")
 	EventTypeCallFinish   = EventType("callFinish")
 )
 
+// ValidateContextInput returns the error a context tool reference with arguments, as in "tool with ${x} as y",
+// fails with at runtime because its mapping does not match the arguments of the tool.
+func ValidateContextInput(prg *types.Program, ref types.ToolReference) error {
+	_, err := getContextInput(prg, ref, "{}")
+	return err
+}
+
 func getContextInput(prg *types.Program, ref types.ToolReference, input string) (string, error) {
 	if ref.Arg == "" {
 		return "", nil
@@ -387,13 +450,7 @@ func (r *Runner) start(callCtx engine.Context, state *State, monitor Monitor, en
 		return newState, nil
 	}
 
-	e := engine.Engine{
-		Model:          r.c,
-		RuntimeManager: r.runtimeManager,
-		Progress:       progress,
-		Env:            env,
-		Ports:          &r.ports,
-	}
+	e := r.newEngine(progress, env)
 
 	monitor.Event(Event{
 		Time:        time.Now(),
@@ -404,6 +461,18 @@ func (r *Runner) start(callCtx engine.Context, state *State, monitor Monitor, en
 
 	callCtx.Ctx = context2.AddPauseFuncToCtx(callCtx.Ctx, monitor.Pause)
 
+	if callCtx.Tool.IsSequence() || callCtx.Tool.IsMap() {
+		result, err := r.runWorkflow(callCtx, monitor, env, input)
+		if err != nil {
+			return nil, err
+		}
+		return &State{
+			Continuation: &engine.Return{
+				Result: &result,
+			},
+		}, nil
+	}
+
 	ret, err := e.Start(callCtx, input)
 	if err != nil {
 		return nil, err
@@ -490,14 +559,49 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 		}
 	}
 
+	var (
+		budget     = getBudget(callCtx.Ctx)
+		reprompted bool
+		wrappedUp  bool
+	)
+
 	for {
 		if state.Continuation.Result != nil && len(state.Continuation.Calls) == 0 && state.SubCallID == "" && state.ResumeInput == nil {
+			output, outputErr := validateOutput(callCtx.Tool, *state.Continuation.Result)
+			if outputErr != nil {
+				// The model gets one chance to fix its output
+				if reprompted || state.Continuation.State == nil {
+					return nil, fmt.Errorf("invalid output from tool [%s]: %w", callCtx.Tool.Name, outputErr)
+				}
+				reprompted = true
+
+				if err := budget.check(state); err != nil {
+					return nil, err
+				}
+
+				log.Debugf("re-prompting tool [%s] after invalid output: %v", callCtx.Tool.Name, outputErr)
+				e := r.newEngine(progress, env)
+				nextContinuation, err := e.Continue(callCtx, state.Continuation.State, engine.CallResult{
+					User: fmt.Sprintf(outputSchemaRetryPrompt, outputErr),
+				})
+				if err != nil {
+					return nil, err
+				}
+				state = &State{
+					Continuation: nextContinuation,
+				}
+				continue
+			}
+			state.Continuation.Result = &output
+
 			progressClose()
 			monitor.Event(Event{
 				Time:        time.Now(),
 				CallContext: callCtx.GetCallContext(),
 				Type:        EventTypeCallFinish,
 				Content:     *state.Continuation.Result,
+				Usage:       usageOrNil(callCtx.Usage()),
+				Turns:       turns(state.Continuation.State),
 			})
 			if callCtx.Tool.Chat {
 				return &State{
@@ -510,6 +614,34 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 			}, nil
 		}
 
+		if err := budget.check(state); err != nil {
+			return nil, err
+		}
+
+		if maxTurns := r.turnLimit(callCtx.Tool); maxTurns > 0 && len(state.Continuation.Calls) > 0 && state.SubCallID == "" &&
+			state.ResumeInput == nil && turns(state.Continuation.State) >= maxTurns {
+			// Entry tools may not have a name, so fall back to where the tool comes from
+			toolName := types.FirstSet(callCtx.Tool.Name, callCtx.Tool.Source.Location, callCtx.Tool.ID)
+			if wrappedUp || r.maxTurnsAction != MaxTurnsWrapUp {
+				return nil, &ErrMaxTurns{
+					ToolName: toolName,
+					MaxTurns: maxTurns,
+					State:    state,
+				}
+			}
+			wrappedUp = true
+
+			log.Debugf("tool [%s] reached its maximum of %d turns, asking for a final answer", toolName, maxTurns)
+			nextContinuation, err := wrapUp(callCtx, r.newEngine(progress, env), state)
+			if err != nil {
+				return nil, err
+			}
+			state = &State{
+				Continuation: nextContinuation,
+			}
+			continue
+		}
+
 		monitor.Event(Event{
 			Time:         time.Now(),
 			CallContext:  callCtx.GetCallContext(),
@@ -555,13 +687,7 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 			ToolResults: len(callResults),
 		})
 
-		e := engine.Engine{
-			Model:          r.c,
-			RuntimeManager: r.runtimeManager,
-			Progress:       progress,
-			Env:            env,
-			Ports:          &r.ports,
-		}
+		e := r.newEngine(progress, env)
 
 		var (
 			contentInput string
@@ -582,6 +708,13 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 			})
 		}
 
+		if err := budget.check(&State{
+			Continuation: state.Continuation,
+			SubCalls:     callResults,
+		}); err != nil {
+			return nil, err
+		}
+
 		nextContinuation, err := e.Continue(callCtx, state.Continuation.State, engineResults...)
 		if err != nil {
 			return nil, err
@@ -594,6 +727,25 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 	}
 }
 
+func (r *Runner) newEngine(progress chan<- types.CompletionStatus, env []string) engine.Engine {
+	return engine.Engine{
+		Model:           r.c,
+		RuntimeManager:  r.runtimeManager,
+		Progress:        progress,
+		Env:             env,
+		Ports:           &r.ports,
+		ContextStrategy: r.strategy,
+		Timeout:         r.timeout,
+	}
+}
+
+func usageOrNil(usage types.Usage) *types.Usage {
+	if usage.IsZero() {
+		return nil
+	}
+	return &usage
+}
+
 func streamProgress(callCtx *engine.Context, monitor Monitor) (chan<- types.CompletionStatus, func()) {
 	progress := make(chan types.CompletionStatus)
 
@@ -602,7 +754,16 @@ func streamProgress(callCtx *engine.Context, monitor Monitor) (chan<- types.Comp
 	go func() {
 		defer wg.Done()
 		for status := range progress {
-			if message := status.PartialResponse; message != nil {
+			if retry := status.Retry; retry != nil {
+				monitor.Event(Event{
+					Time:             time.Now(),
+					CallContext:      callCtx.GetCallContext(),
+					Type:             EventTypeCallRetry,
+					ChatCompletionID: status.CompletionID,
+					Retry:            retry,
+					Content:          retry.Error,
+				})
+			} else if message := status.PartialResponse; message != nil {
 				monitor.Event(Event{
 					Time:             time.Now(),
 					CallContext:      callCtx.GetCallContext(),
@@ -611,14 +772,20 @@ func streamProgress(callCtx *engine.Context, monitor Monitor) (chan<- types.Comp
 					Content:          message.String(),
 				})
 			} else {
+				if !status.Usage.IsZero() {
+					callCtx.AddUsage(status.Usage)
+					getBudget(callCtx.Ctx).add(types.FirstSet(status.Model, callCtx.Tool.ModelName), status.Usage)
+				}
 				monitor.Event(Event{
 					Time:               time.Now(),
 					CallContext:        callCtx.GetCallContext(),
 					Type:               EventTypeChat,
 					ChatCompletionID:   status.CompletionID,
+					ChatModel:          status.Model,
 					ChatRequest:        status.Request,
 					ChatResponse:       status.Response,
 					ChatResponseCached: status.Cached,
+					Usage:              usageOrNil(status.Usage),
 				})
 			}
 		}
@@ -651,17 +818,24 @@ func (r *Runner) subCallResume(ctx context.Context, parentContext engine.Context
 	return r.resume(callCtx, monitor, env, state)
 }
 
+// toolResult is the state of a tool call that was answered without running the tool.
+func toolResult(result string) *State {
+	return &State{
+		Result: &result,
+	}
+}
+
 type SubCallResult struct {
 	ToolID string `json:"toolId,omitempty"`
 	CallID string `json:"callId,omitempty"`
 	State  *State `json:"state,omitempty"`
 }
 
-func (r *Runner) newDispatcher(ctx context.Context) dispatcher {
+func (r *Runner) newDispatcher(ctx context.Context, tool types.Tool) dispatcher {
 	if r.sequential {
 		return newSerialDispatcher(ctx)
 	}
-	return newParallelDispatcher(ctx)
+	return newParallelDispatcher(ctx, tool.MaxParallelCalls)
 }
 
 func (r *Runner) subCalls(callCtx engine.Context, monitor Monitor, env []string, state *State, toolCategory engine.ToolCategory) (_ *State, callResults []SubCallResult, _ error) {
@@ -704,7 +878,7 @@ func (r *Runner) subCalls(callCtx engine.Context, monitor Monitor, env []string,
 		return state, callResults, nil
 	}
 
-	d := r.newDispatcher(callCtx.Ctx)
+	d := r.newDispatcher(callCtx.Ctx, callCtx.Tool)
 
 	// Sort the id so if sequential the results are predictable
 	ids := maps.Keys(state.Continuation.Calls)
@@ -713,7 +887,22 @@ func (r *Runner) subCalls(callCtx engine.Context, monitor Monitor, env []string,
 	for _, id := range ids {
 		call := state.Continuation.Calls[id]
 		d.Run(func(ctx context.Context) error {
-			result, err := r.subCall(ctx, callCtx, monitor, env, call.ToolID, call.Input, id, "")
+			var (
+				result *State
+				err    error
+			)
+			if invalid := validateArguments(callCtx.Program.ToolSet[call.ToolID], call.Input); invalid != nil {
+				// Let the model correct the call instead of running the tool with bad input
+				log.Debugf("invalid arguments for tool [%s]: %s", invalid.Tool, call.Input)
+				result = toolResult(invalid.String())
+			} else {
+				result, err = r.subCall(ctx, callCtx, monitor, env, call.ToolID, call.Input, id, "")
+				if timeoutErr := (*engine.ErrTimeout)(nil); errors.As(err, &timeoutErr) {
+					// Let the model know the tool timed out instead of failing the whole run
+					log.Errorf("%v", err)
+					result, err = toolResult(fmt.Sprintf("ERROR: %v", err)), nil
+				}
+			}
 			if err != nil {
 				return err
 			}
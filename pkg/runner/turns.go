@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	// MaxTurnsError stops the call with an ErrMaxTurns when a tool reaches its maximum number of turns.
+	MaxTurnsError = "error"
+	// MaxTurnsWrapUp asks the model for a final answer, without tool calls, when a tool reaches its maximum
+	// number of turns.
+	MaxTurnsWrapUp = "wrap-up"
+
+	maxTurnsToolResult = "This tool was not run because the maximum number of turns was reached. Do not call any more tools, " +
+		"respond now with your final answer based on what you have so far."
+)
+
+// ErrMaxTurns is returned when the model of a tool keeps calling tools after the maximum number of turns.
+type ErrMaxTurns struct {
+	ToolName string `json:"toolName,omitempty"`
+	MaxTurns int    `json:"maxTurns,omitempty"`
+	State    *State `json:"state,omitempty"`
+}
+
+func (e *ErrMaxTurns) Error() string {
+	return fmt.Sprintf("tool [%s] reached its maximum of %d turns", e.ToolName, e.MaxTurns)
+}
+
+func (r *Runner) turnLimit(tool types.Tool) int {
+	if tool.MaxTurns > 0 {
+		return tool.MaxTurns
+	}
+	return r.maxTurns
+}
+
+// turns returns the number of completions since the last user message, which is the input of the tool or of
+// the last chat message.
+func turns(state *engine.State) (result int) {
+	if state == nil {
+		return 0
+	}
+
+	messages := state.Completion.Messages
+	if state.OriginalMessages != nil {
+		// The messages sent to the model may have been summarized
+		messages = state.OriginalMessages
+	}
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		switch messages[i].Role {
+		case types.CompletionMessageRoleTypeUser:
+			return
+		case types.CompletionMessageRoleTypeAssistant:
+			result++
+		}
+	}
+	return
+}
+
+// wrapUp answers the pending tool calls with a request for a final answer and sends them to the model with
+// tool calls disabled.
+func wrapUp(callCtx engine.Context, e engine.Engine, state *State) (*engine.Return, error) {
+	var results []engine.CallResult
+	for id, call := range state.Continuation.Calls {
+		results = append(results, engine.CallResult{
+			ToolID: call.ToolID,
+			CallID: id,
+			Result: maxTurnsToolResult,
+		})
+	}
+
+	engineState := *state.Continuation.State
+	engineState.Completion.DisableToolCalls = true
+	ret, err := e.Continue(callCtx, &engineState, results...)
+	if err != nil {
+		return nil, err
+	}
+	if ret.State != nil {
+		// Only the wrap-up completion has the tool calls disabled, not the next turns of a chat
+		ret.State.Completion.DisableToolCalls = false
+	}
+	return ret, nil
+}
@@ -0,0 +1,113 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// workflowSteps returns the tools a sys.sequence or sys.map tool runs, one per line after the first line of its
+// instructions, or its tools in order if it lists none.
+func workflowSteps(tool types.Tool) (result []string, _ error) {
+	_, body, _ := strings.Cut(tool.Instructions, "\n")
+	for _, line := range strings.Split(body, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			result = append(result, strings.ToLower(line))
+		}
+	}
+	if len(result) == 0 {
+		result = tool.Tools
+	}
+
+	for _, step := range result {
+		if _, ok := tool.ToolMapping[step]; !ok {
+			return nil, fmt.Errorf("tool [%s] runs [%s] which is not in its tools", tool.Name, step)
+		}
+	}
+	return result, nil
+}
+
+// runWorkflow runs the tools of a sys.sequence or sys.map tool as sub-calls, without calling a model.
+func (r *Runner) runWorkflow(callCtx engine.Context, monitor Monitor, env []string, input string) (string, error) {
+	steps, err := workflowSteps(callCtx.Tool)
+	if err != nil {
+		return "", err
+	}
+
+	if callCtx.Tool.IsMap() {
+		if len(steps) != 1 {
+			return "", fmt.Errorf("tool [%s] must map exactly one tool, found %d", callCtx.Tool.Name, len(steps))
+		}
+		return r.runMap(callCtx, monitor, env, steps[0], input)
+	}
+
+	output := input
+	for _, step := range steps {
+		output, err = r.runStep(callCtx.Ctx, callCtx, monitor, env, step, output)
+		if err != nil {
+			return "", err
+		}
+	}
+	return output, nil
+}
+
+// runMap runs a tool once for every item of a JSON array input, in parallel, and returns the JSON array of
+// the outputs. Outputs that are JSON are kept as is, others become strings.
+func (r *Runner) runMap(callCtx engine.Context, monitor Monitor, env []string, step, input string) (string, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal([]byte(input), &items); err != nil {
+		return "", fmt.Errorf("input of tool [%s] must be a JSON array: %w", callCtx.Tool.Name, err)
+	}
+
+	var (
+		outputs = make([]json.RawMessage, len(items))
+		d       = r.newDispatcher(callCtx.Ctx, callCtx.Tool)
+	)
+	for i, item := range items {
+		d.Run(func(ctx context.Context) error {
+			itemInput := string(item)
+			var s string
+			if err := json.Unmarshal(item, &s); err == nil {
+				itemInput = s
+			}
+
+			output, err := r.runStep(ctx, callCtx, monitor, env, step, itemInput)
+			if err != nil {
+				return err
+			}
+
+			if json.Valid([]byte(output)) {
+				outputs[i] = json.RawMessage(output)
+			} else if outputs[i], err = json.Marshal(output); err != nil {
+				return err
+			}
+			return nil
+		})
+	}
+	if err := d.Wait(); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(outputs)
+	return string(data), err
+}
+
+func (r *Runner) runStep(ctx context.Context, callCtx engine.Context, monitor Monitor, env []string, step, input string) (string, error) {
+	toolID := callCtx.Tool.ToolMapping[step]
+	if invalid := validateArguments(callCtx.Program.ToolSet[toolID], input); invalid != nil {
+		return "", fmt.Errorf("invalid input for tool [%s] of [%s]: %s", step, callCtx.Tool.Name, invalid.String())
+	}
+
+	state, err := r.subCall(ctx, callCtx, monitor, env, toolID, input, "", engine.NoCategory)
+	if err != nil {
+		return "", err
+	}
+	if state.Result == nil {
+		return "", fmt.Errorf("tool [%s] of [%s] asked for user input, which workflow tools do not support", step, callCtx.Tool.Name)
+	}
+	return *state.Result, nil
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gptscript-ai/gptscript/pkg/openai"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
 	"github.com/gptscript-ai/gptscript/pkg/tests/tester"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/hexops/autogold/v2"
@@ -687,3 +690,339 @@ func TestExport(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "TEST RESULT CALL: 3", x)
 }
+
+func respondWithUsage(r *tester.Runner) {
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name: "bob",
+		},
+		Usage: types.Usage{PromptTokens: 200, CompletionTokens: 100, TotalTokens: 300},
+	}, tester.Result{
+		Text:  "Doing great",
+		Usage: types.Usage{PromptTokens: 200, CompletionTokens: 100, TotalTokens: 300},
+	})
+}
+
+func TestMaxTokensTotal(t *testing.T) {
+	r := tester.NewRunner(t, runner.Options{
+		MaxTokensTotal: 500,
+	})
+	respondWithUsage(r)
+
+	_, err := r.Run("", "")
+	var budgetErr *runner.ErrBudgetExceeded
+	require.ErrorAs(t, err, &budgetErr)
+	r.AssertResponded(t)
+	assert.Equal(t, runner.BudgetTokens, budgetErr.Budget)
+	assert.Equal(t, float64(600), budgetErr.Used)
+	require.NotNil(t, budgetErr.State)
+	require.Len(t, budgetErr.State.SubCalls, 1)
+	assert.Equal(t, "Doing great", *budgetErr.State.SubCalls[0].State.Result)
+}
+
+func TestMaxCost(t *testing.T) {
+	r := tester.NewRunner(t, runner.Options{
+		MaxCost: 0.5,
+		Prices: runner.PriceTable{
+			"test-model": {Prompt: 1000, Completion: 1000},
+		},
+	})
+	respondWithUsage(r)
+
+	_, err := r.Run("", "")
+	var budgetErr *runner.ErrBudgetExceeded
+	require.ErrorAs(t, err, &budgetErr)
+	r.AssertResponded(t)
+	assert.Equal(t, runner.BudgetCost, budgetErr.Budget)
+	assert.InDelta(t, 0.6, budgetErr.Cost, 0.0001)
+	assert.EqualError(t, err, "cost budget exceeded: used $0.6000 of $0.5000")
+}
+
+func TestUsage(t *testing.T) {
+	m := &tester.Monitor{}
+	r := tester.NewRunner(t, runner.Options{
+		MonitorFactory: m,
+	})
+	respondWithUsage(r)
+	r.RespondWith(tester.Result{
+		Text:  "Bob is doing great",
+		Usage: types.Usage{PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150},
+	})
+
+	x, err := r.Run("", "")
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	assert.Equal(t, "Bob is doing great", x)
+
+	var chatUsage []types.Usage
+	for _, event := range m.Events(runner.EventTypeChat) {
+		if event.Usage != nil {
+			chatUsage = append(chatUsage, *event.Usage)
+		}
+	}
+	assert.Equal(t, []types.Usage{
+		{PromptTokens: 200, CompletionTokens: 100, TotalTokens: 300},
+		{PromptTokens: 200, CompletionTokens: 100, TotalTokens: 300},
+		{PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150},
+	}, chatUsage)
+
+	// Each call reports the usage of its own completions and of its sub calls
+	finished := m.Events(runner.EventTypeCallFinish)
+	require.Len(t, finished, 2)
+	assert.Equal(t, "bob", finished[0].CallContext.Tool.Name)
+	assert.Equal(t, &types.Usage{PromptTokens: 200, CompletionTokens: 100, TotalTokens: 300}, finished[0].Usage)
+	assert.Equal(t, "", finished[1].CallContext.ParentID)
+	assert.Equal(t, &types.Usage{PromptTokens: 500, CompletionTokens: 250, TotalTokens: 750}, finished[1].Usage)
+}
+
+func TestCredentialEnv(t *testing.T) {
+	t.Setenv("GPTSCRIPT_CONFIG_FILE", filepath.Join(t.TempDir(), "config.json"))
+
+	r := tester.NewRunner(t)
+	prg, err := r.Load("credential.gpt")
+	require.NoError(t, err)
+
+	// Only the variables set by the credential tool are returned
+	env, err := r.CredentialEnv(context.Background(), prg, os.Environ())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"MODEL_API_KEY": "from credential"}, env)
+
+	// An override is used instead of running the credential tool
+	r = tester.NewRunner(t, runner.Options{
+		CredentialOverride: prg.Name + ":MODEL_API_KEY=overridden",
+	})
+	env, err = r.CredentialEnv(context.Background(), prg, os.Environ())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"MODEL_API_KEY": "overridden"}, env)
+}
+
+func TestOutputSchema(t *testing.T) {
+	r := tester.NewRunner(t)
+	r.RespondWith(tester.Result{
+		Text: "```json\n{\"age\": 42}\n```",
+	}, tester.Result{
+		Text: "```json\n{\"name\": \"Bob\", \"age\": 42}\n```",
+	})
+
+	x, err := r.Run("", "")
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	assert.Equal(t, `{"name": "Bob", "age": 42}`, x)
+}
+
+func TestOutputSchemaInvalid(t *testing.T) {
+	r := tester.NewRunner(t)
+	r.RespondWith(tester.Result{
+		Text: "I am Bob",
+	}, tester.Result{
+		Text: `{"name": 42}`,
+	})
+
+	_, err := r.Run("", "")
+	r.AssertResponded(t)
+	require.ErrorContains(t, err, "output does not match the output schema at /name")
+}
+
+func TestMaxTurns(t *testing.T) {
+	r := tester.NewRunner(t)
+	ping := tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name: "ping",
+		},
+	}
+	r.RespondWith(ping, ping)
+
+	_, err := r.Run("", "")
+	r.AssertResponded(t)
+	var turnsErr *runner.ErrMaxTurns
+	require.ErrorAs(t, err, &turnsErr)
+	assert.Equal(t, 2, turnsErr.MaxTurns)
+	assert.EqualError(t, err, "tool [testdata/TestMaxTurns/test.gpt] reached its maximum of 2 turns")
+}
+
+func TestMaxTurnsWrapUp(t *testing.T) {
+	r := tester.NewRunner(t, runner.Options{
+		MaxTurnsAction: runner.MaxTurnsWrapUp,
+	})
+	ping := tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name: "ping",
+		},
+	}
+	r.RespondWith(ping, ping, tester.Result{
+		Text: "No pong",
+	})
+
+	x, err := r.Run("", "")
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	assert.Equal(t, "No pong", x)
+}
+
+func TestMaxTurnsWrapUpChat(t *testing.T) {
+	r := tester.NewRunner(t, runner.Options{
+		MaxTurnsAction: runner.MaxTurnsWrapUp,
+	})
+	ping := tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name: "ping",
+		},
+	}
+	r.RespondWith(ping, ping, tester.Result{
+		Text: "No pong",
+	}, ping, tester.Result{
+		Text: "Got a ping",
+	})
+
+	prg, err := r.Load("")
+	require.NoError(t, err)
+
+	resp, err := r.Chat(context.Background(), nil, prg, os.Environ(), "Hello")
+	require.NoError(t, err)
+	assert.Equal(t, "No pong", resp.Content)
+
+	// The next turn of the chat may call tools again
+	resp, err = r.Chat(context.Background(), resp.State, prg, os.Environ(), "Again")
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	assert.Equal(t, "Got a ping", resp.Content)
+}
+
+func TestTimeout(t *testing.T) {
+	r := tester.NewRunner(t)
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name: "slow",
+		},
+	}, tester.Result{
+		Text: "The tool timed out",
+	})
+
+	start := time.Now()
+	x, err := r.Run("", "")
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	assert.Equal(t, "The tool timed out", x)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestInvalidArguments(t *testing.T) {
+	r := tester.NewRunner(t)
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name:      "greet",
+			Arguments: `{"name": ["Bob"]}`,
+		},
+	}, tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name:      "greet",
+			Arguments: `{"name": "Bob"}`,
+		},
+	}, tester.Result{
+		Text: "I said hello to Bob",
+	})
+
+	x, err := r.Run("", "")
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	assert.Equal(t, "I said hello to Bob", x)
+}
+
+func TestOmittedDefaultArgument(t *testing.T) {
+	r := tester.NewRunner(t)
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name:      "greet",
+			Arguments: `{}`,
+		},
+	}, tester.Result{
+		Text: "I said hello 3 times",
+	})
+
+	x, err := r.Run("", "")
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	assert.Equal(t, "I said hello 3 times", x)
+}
+
+func TestArgInterpolation(t *testing.T) {
+	r := tester.NewRunner(t)
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name:      "greeter",
+			Arguments: `{"name": "Bob"}`,
+		},
+	}, tester.Result{
+		Text: "Bonjour Bob",
+	}, tester.Result{
+		Text: "Done",
+	})
+
+	x, err := r.Run("", "")
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	assert.Equal(t, "Done", x)
+}
+
+// calls returns the tool name, parent tool name, and content of the events, in the order of the events
+func calls(events []runner.Event) (result [][3]string) {
+	names := map[string]string{}
+	for _, event := range events {
+		names[event.CallContext.ID] = event.CallContext.Tool.Name
+		result = append(result, [3]string{event.CallContext.Tool.Name, names[event.CallContext.ParentID], event.Content})
+	}
+	return
+}
+
+func TestSequence(t *testing.T) {
+	m := &tester.Monitor{}
+	r := tester.NewRunner(t, runner.Options{
+		MonitorFactory: m,
+	})
+
+	x, err := r.Run("", "hello")
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	assert.Equal(t, "HELLO!", x)
+
+	// Each step is a call of the sequence tool that gets the output of the step before
+	assert.Equal(t, [][3]string{
+		{"pipeline", "", "hello"},
+		{"upper", "pipeline", "hello"},
+		{"upper", "pipeline", "HELLO"},
+		{"exclaim", "pipeline", "HELLO"},
+		{"exclaim", "pipeline", "HELLO!"},
+		{"upper", "pipeline", "HELLO!"},
+		{"upper", "pipeline", "HELLO!"},
+		{"pipeline", "", "HELLO!"},
+	}, calls(m.Events(runner.EventTypeCallStart, runner.EventTypeCallFinish)))
+}
+
+func TestMap(t *testing.T) {
+	m := &tester.Monitor{}
+	r := tester.NewRunner(t, runner.Options{
+		MonitorFactory: m,
+	})
+
+	x, err := r.Run("", `["a", 3, {"x": 1}]`)
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	assert.Equal(t, `["a",3,{"x":1}]`, x)
+
+	// The items run in parallel, so only the calls of the whole map are in order
+	events := calls(m.Events(runner.EventTypeCallStart, runner.EventTypeCallFinish))
+	require.Len(t, events, 8)
+	assert.Equal(t, [3]string{"each", "", `["a", 3, {"x": 1}]`}, events[0])
+	assert.ElementsMatch(t, [][3]string{
+		{"echo", "each", "a"},
+		{"echo", "each", "a"},
+		{"echo", "each", "3"},
+		{"echo", "each", "3"},
+		{"echo", "each", `{"x": 1}`},
+		{"echo", "each", `{"x": 1}`},
+	}, events[1:7])
+	assert.Equal(t, [3]string{"each", "", `["a",3,{"x":1}]`}, events[7])
+
+	_, err = r.Run("", "not a list")
+	require.ErrorContains(t, err, "must be a JSON array")
+}
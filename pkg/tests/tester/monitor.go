@@ -0,0 +1,44 @@
+package tester
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// Monitor records the events of the runs it monitors. Set it as the MonitorFactory of the runner options.
+type Monitor struct {
+	lock   sync.Mutex
+	events []runner.Event
+}
+
+func (m *Monitor) Start(context.Context, *types.Program, []string, string) (runner.Monitor, error) {
+	return m, nil
+}
+
+func (m *Monitor) Event(event runner.Event) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.events = append(m.events, event)
+}
+
+func (m *Monitor) Pause() func() {
+	return func() {}
+}
+
+func (m *Monitor) Stop(string, error) {}
+
+// Events returns the recorded events of a type, or all the events if no type is given.
+func (m *Monitor) Events(eventTypes ...runner.EventType) (result []runner.Event) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, event := range m.events {
+		if len(eventTypes) == 0 || slices.Contains(eventTypes, event.Type) {
+			result = append(result, event)
+		}
+	}
+	return
+}
@@ -25,10 +25,11 @@ type Result struct {
 	Text    string
 	Func    types.CompletionFunctionCall
 	Content []types.ContentPart
+	Usage   types.Usage
 	Err     error
 }
 
-func (c *Client) Call(_ context.Context, messageRequest types.CompletionRequest, _ chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+func (c *Client) Call(_ context.Context, messageRequest types.CompletionRequest, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
 	msgData, err := json.MarshalIndent(messageRequest, "", "  ")
 	require.NoError(c.t, err)
 
@@ -50,6 +51,13 @@ func (c *Client) Call(_ context.Context, messageRequest types.CompletionRequest,
 	result := c.result[0]
 	c.result = c.result[1:]
 
+	if !result.Usage.IsZero() {
+		status <- types.CompletionStatus{
+			CompletionID: fmt.Sprintf("%d", c.id),
+			Usage:        result.Usage,
+		}
+	}
+
 	if result.Err != nil {
 		return nil, result.Err
 	}
@@ -141,16 +149,16 @@ func (r *Runner) RespondWith(result ...Result) {
 	r.Client.result = append(r.Client.result, result...)
 }
 
-func NewRunner(t *testing.T) *Runner {
+func NewRunner(t *testing.T, opts ...runner.Options) *Runner {
 	t.Helper()
 
 	c := &Client{
 		t: t,
 	}
 
-	run, err := runner.New(c, "default", runner.Options{
+	run, err := runner.New(c, "default", append([]runner.Options{{
 		Sequential: true,
-	})
+	}}, opts...)...)
 	require.NoError(t, err)
 
 	return &Runner{
@@ -0,0 +1,62 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// argModifiers formats the type, required, default and enum values of an argument the way they are written
+// in "Args:" lines, or returns an empty string if the argument is a plain optional string.
+func argModifiers(schema *openapi3.Schema, required bool) string {
+	var modifiers []string
+
+	switch {
+	case schema.Type == "array" && schema.Items != nil && schema.Items.Value != nil && schema.Items.Value.Type != "string":
+		modifiers = append(modifiers, "array of "+schema.Items.Value.Type)
+	case schema.Type != "" && schema.Type != "string":
+		modifiers = append(modifiers, schema.Type)
+	}
+	if required {
+		modifiers = append(modifiers, "required")
+	}
+	if len(schema.Enum) > 0 {
+		var values []string
+		for _, v := range schema.Enum {
+			values = append(values, argValueString(v))
+		}
+		modifiers = append(modifiers, "enum="+strings.Join(values, "|"))
+	}
+	if schema.Default != nil {
+		modifiers = append(modifiers, "default="+argValueString(schema.Default))
+	}
+
+	return strings.Join(modifiers, ", ")
+}
+
+// argValueString formats a default or enum value. Strings that would not parse back as written are quoted as JSON.
+func argValueString(v any) string {
+	switch v := v.(type) {
+	case string:
+		if v != strings.TrimSpace(v) || strings.ContainsAny(v, `,|()"[]{}`) {
+			buf := &bytes.Buffer{}
+			enc := json.NewEncoder(buf)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(v); err == nil {
+				return strings.TrimSpace(buf.String())
+			}
+		}
+		return v
+	case map[string]any, []any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/getkin/kin-openapi/openapi3"
@@ -18,6 +19,12 @@ type CompletionRequest struct {
 	JSONResponse         bool
 	Grammar              string
 	Cache                *bool
+	// ModelFallbacks are tried in order when the request to Model fails
+	ModelFallbacks []string `json:",omitempty"`
+	// OutputSchema is the JSON schema the response must match
+	OutputSchema *openapi3.Schema `json:",omitempty"`
+	// DisableToolCalls keeps the tools in the request but does not let the model call them
+	DisableToolCalls bool `json:",omitempty"`
 }
 
 type CompletionTool struct {
@@ -51,11 +58,48 @@ type CompletionMessage struct {
 
 type CompletionStatus struct {
 	CompletionID    string
+	Model           string
 	Request         any
 	Response        any
+	Usage           Usage
 	Cached          bool
 	Chunks          any
 	PartialResponse *CompletionMessage
+	Retry           *CompletionRetry
+}
+
+// CompletionRetry describes a failed attempt at a completion that is going to be retried after Delay.
+type CompletionRetry struct {
+	Attempt    int           `json:"attempt,omitempty"`
+	MaxRetries int           `json:"maxRetries,omitempty"`
+	Delay      time.Duration `json:"delay,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// Usage is the number of tokens consumed by one or more completions. CachedTokens is the part of
+// PromptTokens that the provider served from its prompt cache.
+type Usage struct {
+	PromptTokens     int `json:"promptTokens,omitempty"`
+	CompletionTokens int `json:"completionTokens,omitempty"`
+	CachedTokens     int `json:"cachedTokens,omitempty"`
+	TotalTokens      int `json:"totalTokens,omitempty"`
+}
+
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		CachedTokens:     u.CachedTokens + other.CachedTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+func (u Usage) IsZero() bool {
+	return u == Usage{}
+}
+
+func (u Usage) String() string {
+	return fmt.Sprintf("prompt=%d completion=%d cached=%d total=%d", u.PromptTokens, u.CompletionTokens, u.CachedTokens, u.TotalTokens)
 }
 
 func (in CompletionMessage) IsToolCall() bool {
@@ -92,6 +136,7 @@ func (in CompletionMessage) String() string {
 type ContentPart struct {
 	Text     string              `json:"text,omitempty"`
 	ToolCall *CompletionToolCall `json:"toolCall,omitempty"`
+	Image    *ImageURL           `json:"image,omitempty"`
 }
 
 type CompletionToolCall struct {
@@ -0,0 +1,27 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurationJSON(t *testing.T) {
+	data, err := json.Marshal(Parameters{Timeout: Duration(90 * time.Second)})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"timeout":"1m30s"`)
+
+	var params Parameters
+	require.NoError(t, json.Unmarshal(data, &params))
+	assert.Equal(t, Duration(90*time.Second), params.Timeout)
+
+	// Programs written before timeouts were strings hold nanoseconds
+	require.NoError(t, json.Unmarshal([]byte(`{"timeout": 30000000000}`), &params))
+	assert.Equal(t, Duration(30*time.Second), params.Timeout)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"timeout": "30"}`), &params))
+	assert.Error(t, json.Unmarshal([]byte(`{"timeout": true}`), &params))
+}
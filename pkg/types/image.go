@@ -0,0 +1,159 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	contentTypeText  = "text"
+	contentTypeImage = "image"
+)
+
+// ImageURL is an image sent to vision models. URL is either an http(s) URL or a data URL.
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// contentEnvelope carries images through the string inputs and outputs of tools. A tool output of
+// {"type": "image", "url": "data:image/png;base64,..."} or {"type": "image", "mimeType": "image/png", "data": "..."}
+// is sent to the model as an image, as is a JSON array of text and image envelopes.
+type contentEnvelope struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	URL      string `json:"url,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Data     string `json:"data,omitempty"`
+}
+
+func (c contentEnvelope) part() (ContentPart, bool) {
+	switch c.Type {
+	case contentTypeText:
+		return ContentPart{Text: c.Text}, true
+	case contentTypeImage:
+		if c.URL != "" {
+			return ContentPart{Image: &ImageURL{URL: c.URL}}, true
+		}
+		if strings.HasPrefix(c.MimeType, "image/") && c.Data != "" {
+			return ContentPart{Image: &ImageURL{URL: "data:" + c.MimeType + ";base64," + c.Data}}, true
+		}
+	}
+	return ContentPart{}, false
+}
+
+// Content converts the input or output of a tool to content parts, turning image envelopes into images.
+// Anything else is returned as text.
+func Content(text string) []ContentPart {
+	trimmed := strings.TrimSpace(text)
+	if !strings.Contains(trimmed, `"`+contentTypeImage+`"`) {
+		return Text(text)
+	}
+
+	var envelopes []contentEnvelope
+	if strings.HasPrefix(trimmed, "{") {
+		var envelope contentEnvelope
+		if err := json.Unmarshal([]byte(trimmed), &envelope); err != nil {
+			return Text(text)
+		}
+		envelopes = append(envelopes, envelope)
+	} else if strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal([]byte(trimmed), &envelopes); err != nil {
+			return Text(text)
+		}
+	}
+
+	var (
+		result   []ContentPart
+		hasImage bool
+	)
+	for _, envelope := range envelopes {
+		part, ok := envelope.part()
+		if !ok {
+			return Text(text)
+		}
+		hasImage = hasImage || part.Image != nil
+		result = append(result, part)
+	}
+	if !hasImage {
+		return Text(text)
+	}
+	return result
+}
+
+// ContentString is the inverse of Content, it encodes content parts with images as envelopes.
+func ContentString(parts []ContentPart) string {
+	var (
+		envelopes []contentEnvelope
+		text      []string
+	)
+	for _, part := range parts {
+		if part.Image != nil {
+			envelopes = append(envelopes, contentEnvelope{Type: contentTypeImage, URL: part.Image.URL})
+		} else if part.Text != "" {
+			envelopes = append(envelopes, contentEnvelope{Type: contentTypeText, Text: part.Text})
+			text = append(text, part.Text)
+		}
+	}
+	if len(envelopes) == len(text) {
+		return strings.Join(text, "\n")
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if len(envelopes) == 1 {
+		data, err = json.Marshal(envelopes[0])
+	} else {
+		data, err = json.Marshal(envelopes)
+	}
+	if err != nil {
+		return strings.Join(text, "\n")
+	}
+	return string(data)
+}
+
+// IsImageFile returns true if the name has the extension of an image format supported by vision models.
+func IsImageFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+		return true
+	}
+	return false
+}
+
+// ImageDataURL encodes the content of an image file as a data URL.
+func ImageDataURL(name string, data []byte) (string, error) {
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+	if !strings.HasPrefix(mimeType, "image/") {
+		mimeType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", fmt.Errorf("%s is not an image, detected type %s", name, mimeType)
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// ReadImage returns an image part for a data URL, an http(s) URL or the path of a local image file.
+func ReadImage(nameOrURL string) (ContentPart, error) {
+	if strings.HasPrefix(nameOrURL, "data:") || strings.HasPrefix(nameOrURL, "https://") || strings.HasPrefix(nameOrURL, "http://") {
+		return ContentPart{Image: &ImageURL{URL: nameOrURL}}, nil
+	}
+
+	data, err := os.ReadFile(nameOrURL)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read image: %w", err)
+	}
+	url, err := ImageDataURL(nameOrURL, data)
+	if err != nil {
+		return ContentPart{}, err
+	}
+	return ContentPart{Image: &ImageURL{URL: url}}, nil
+}
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContent(t *testing.T) {
+	assert.Equal(t, Text("hello"), Content("hello"))
+	assert.Equal(t, Text(`{"type": "text", "text": "hi"}`), Content(`{"type": "text", "text": "hi"}`))
+	assert.Equal(t, Text(`{"type": "image"}`), Content(`{"type": "image"}`))
+
+	assert.Equal(t, []ContentPart{{Image: &ImageURL{URL: "data:image/png;base64,AAAA"}}},
+		Content(`{"type": "image", "mimeType": "image/png", "data": "AAAA"}`))
+	assert.Equal(t, []ContentPart{{Text: "look"}, {Image: &ImageURL{URL: "https://example.com/a.png"}}},
+		Content(`[{"type": "text", "text": "look"}, {"type": "image", "url": "https://example.com/a.png"}]`))
+}
+
+func TestContentString(t *testing.T) {
+	autogold.Expect("hello").Equal(t, ContentString(Text("hello")))
+
+	parts := []ContentPart{{Text: "look"}, {Image: &ImageURL{URL: "data:image/png;base64,AAAA"}}}
+	s := ContentString(parts)
+	autogold.Expect(`[{"type":"text","text":"look"},{"type":"image","url":"data:image/png;base64,AAAA"}]`).Equal(t, s)
+	assert.Equal(t, parts, Content(s))
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"slices"
 	"sort"
@@ -13,10 +14,13 @@ import (
 )
 
 const (
-	DaemonPrefix  = "#!sys.daemon"
-	OpenAPIPrefix = "#!sys.openapi"
-	PrintPrefix   = "#!sys.print"
-	CommandPrefix = "#!"
+	DaemonPrefix   = "#!sys.daemon"
+	OpenAPIPrefix  = "#!sys.openapi"
+	PrintPrefix    = "#!sys.print"
+	SequencePrefix = "#!sys.sequence"
+	MapPrefix      = "#!sys.map"
+	TemplatePrefix = "#!sys.template"
+	CommandPrefix  = "#!"
 )
 
 type ErrToolNotFound struct {
@@ -146,25 +150,32 @@ func (p Program) SetBlocking() Program {
 type BuiltinFunc func(ctx context.Context, env []string, input string) (string, error)
 
 type Parameters struct {
-	Name            string           `json:"name,omitempty"`
-	Description     string           `json:"description,omitempty"`
-	MaxTokens       int              `json:"maxTokens,omitempty"`
-	ModelName       string           `json:"modelName,omitempty"`
-	ModelProvider   bool             `json:"modelProvider,omitempty"`
-	JSONResponse    bool             `json:"jsonResponse,omitempty"`
-	Chat            bool             `json:"chat,omitempty"`
-	Temperature     *float32         `json:"temperature,omitempty"`
-	Cache           *bool            `json:"cache,omitempty"`
-	InternalPrompt  *bool            `json:"internalPrompt"`
-	Arguments       *openapi3.Schema `json:"arguments,omitempty"`
-	Tools           []string         `json:"tools,omitempty"`
-	GlobalTools     []string         `json:"globalTools,omitempty"`
-	GlobalModelName string           `json:"globalModelName,omitempty"`
-	Context         []string         `json:"context,omitempty"`
-	ExportContext   []string         `json:"exportContext,omitempty"`
-	Export          []string         `json:"export,omitempty"`
-	Credentials     []string         `json:"credentials,omitempty"`
-	Blocking        bool             `json:"-"`
+	Name             string           `json:"name,omitempty"`
+	Description      string           `json:"description,omitempty"`
+	MaxTokens        int              `json:"maxTokens,omitempty"`
+	MaxContext       int              `json:"maxContext,omitempty"`
+	MaxParallelCalls int              `json:"maxParallelCalls,omitempty"`
+	MaxTurns         int              `json:"maxTurns,omitempty"`
+	Timeout          Duration         `json:"timeout,omitempty"`
+	ModelName        string           `json:"modelName,omitempty"`
+	ModelFallbacks   []string         `json:"modelFallbacks,omitempty"`
+	ModelProvider    bool             `json:"modelProvider,omitempty"`
+	JSONResponse     bool             `json:"jsonResponse,omitempty"`
+	OutputSchema     *openapi3.Schema `json:"outputSchema,omitempty"`
+	OutputSchemaRef  string           `json:"outputSchemaRef,omitempty"`
+	Chat             bool             `json:"chat,omitempty"`
+	Temperature      *float32         `json:"temperature,omitempty"`
+	Cache            *bool            `json:"cache,omitempty"`
+	InternalPrompt   *bool            `json:"internalPrompt"`
+	Arguments        *openapi3.Schema `json:"arguments,omitempty"`
+	Tools            []string         `json:"tools,omitempty"`
+	GlobalTools      []string         `json:"globalTools,omitempty"`
+	GlobalModelName  string           `json:"globalModelName,omitempty"`
+	Context          []string         `json:"context,omitempty"`
+	ExportContext    []string         `json:"exportContext,omitempty"`
+	Export           []string         `json:"export,omitempty"`
+	Credentials      []string         `json:"credentials,omitempty"`
+	Blocking         bool             `json:"-"`
 }
 
 type Tool struct {
@@ -238,8 +249,24 @@ func (t Tool) String() string {
 	if t.Parameters.MaxTokens != 0 {
 		_, _ = fmt.Fprintf(buf, "Max Tokens: %d\n", t.Parameters.MaxTokens)
 	}
+	if t.Parameters.MaxContext != 0 {
+		_, _ = fmt.Fprintf(buf, "Max Context: %d\n", t.Parameters.MaxContext)
+	}
+	if t.Parameters.MaxParallelCalls != 0 {
+		_, _ = fmt.Fprintf(buf, "Max Parallel Calls: %d\n", t.Parameters.MaxParallelCalls)
+	}
+	if t.Parameters.MaxTurns != 0 {
+		_, _ = fmt.Fprintf(buf, "Max Turns: %d\n", t.Parameters.MaxTurns)
+	}
+	if t.Parameters.Timeout != 0 {
+		_, _ = fmt.Fprintf(buf, "Timeout: %s\n", t.Parameters.Timeout)
+	}
 	if t.Parameters.ModelName != "" {
-		_, _ = fmt.Fprintf(buf, "Model: %s\n", t.Parameters.ModelName)
+		_, _ = fmt.Fprintf(buf, "Model: %s", t.Parameters.ModelName)
+		for _, fallback := range t.Parameters.ModelFallbacks {
+			_, _ = fmt.Fprintf(buf, ", fallback %s", fallback)
+		}
+		_, _ = fmt.Fprintln(buf)
 	}
 	if t.Parameters.ModelProvider {
 		_, _ = fmt.Fprintf(buf, "Model Provider: true\n")
@@ -247,6 +274,12 @@ func (t Tool) String() string {
 	if t.Parameters.JSONResponse {
 		_, _ = fmt.Fprintln(buf, "JSON Response: true")
 	}
+	if t.Parameters.OutputSchemaRef != "" {
+		_, _ = fmt.Fprintf(buf, "Output Schema: %s\n", t.Parameters.OutputSchemaRef)
+	} else if t.Parameters.OutputSchema != nil {
+		schema, _ := json.Marshal(t.Parameters.OutputSchema)
+		_, _ = fmt.Fprintf(buf, "Output Schema: %s\n", schema)
+	}
 	if t.Parameters.Cache != nil && !*t.Parameters.Cache {
 		_, _ = fmt.Fprintln(buf, "Cache: false")
 	}
@@ -261,7 +294,11 @@ func (t Tool) String() string {
 		sort.Strings(keys)
 		for _, key := range keys {
 			prop := t.Parameters.Arguments.Properties[key]
-			_, _ = fmt.Fprintf(buf, "Args: %s: %s\n", key, prop.Value.Description)
+			if modifiers := argModifiers(prop.Value, slices.Contains(t.Parameters.Arguments.Required, key)); modifiers != "" {
+				_, _ = fmt.Fprintf(buf, "Args: %s (%s): %s\n", key, modifiers, prop.Value.Description)
+			} else {
+				_, _ = fmt.Fprintf(buf, "Args: %s: %s\n", key, prop.Value.Description)
+			}
 		}
 	}
 	if t.Parameters.InternalPrompt != nil {
@@ -387,9 +424,10 @@ type Repo struct {
 }
 
 type ToolSource struct {
-	Location string `json:"location,omitempty"`
-	LineNo   int    `json:"lineNo,omitempty"`
-	Repo     *Repo  `json:"repo,omitempty"`
+	Location   string `json:"location,omitempty"`
+	LineNo     int    `json:"lineNo,omitempty"`
+	BodyLineNo int    `json:"bodyLineNo,omitempty"`
+	Repo       *Repo  `json:"repo,omitempty"`
 }
 
 func (t ToolSource) String() string {
@@ -412,6 +450,18 @@ func (t Tool) IsPrint() bool {
 	return strings.HasPrefix(t.Instructions, PrintPrefix)
 }
 
+func (t Tool) IsSequence() bool {
+	return strings.HasPrefix(t.Instructions, SequencePrefix)
+}
+
+func (t Tool) IsMap() bool {
+	return strings.HasPrefix(t.Instructions, MapPrefix)
+}
+
+func (t Tool) IsTemplate() bool {
+	return strings.HasPrefix(t.Instructions, TemplatePrefix)
+}
+
 func (t Tool) IsHTTP() bool {
 	return strings.HasPrefix(t.Instructions, "#!http://") ||
 		strings.HasPrefix(t.Instructions, "#!https://")